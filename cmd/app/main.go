@@ -2,19 +2,33 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+	_ "time/tzdata"
 
 	"github.com/andrewyazura/duty-reminder/internal/config"
 	"github.com/andrewyazura/duty-reminder/internal/eventbus"
+	"github.com/andrewyazura/duty-reminder/internal/events"
+	"github.com/andrewyazura/duty-reminder/internal/migrations"
 	"github.com/andrewyazura/duty-reminder/internal/scheduler"
 	"github.com/andrewyazura/duty-reminder/internal/server"
 	"github.com/andrewyazura/duty-reminder/internal/services"
+	"github.com/andrewyazura/duty-reminder/internal/telegram"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jonboulle/clockwork"
 )
 
+// shutdownTimeout is how long running requests and event handlers get to
+// finish after SIGINT or SIGTERM
+const shutdownTimeout = 30 * time.Second
+
 func main() {
 	config, err := config.NewConfig()
 	if err != nil {
@@ -22,9 +36,9 @@ func main() {
 		os.Exit(1)
 	}
 
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+	logger := slog.New(eventbus.NewLogHandler(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
 		Level: config.LogLevel,
-	}))
+	})))
 	slog.SetDefault(logger)
 
 	pool, err := pgxpool.New(context.Background(), config.Database.URL)
@@ -34,26 +48,263 @@ func main() {
 	}
 	defer pool.Close()
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrations(context.Background(), pool, logger, os.Args[2:]); err != nil {
+			logger.Error("migration failed", "error", err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	if config.Database.AutoMigrate {
+		if err := runMigrations(context.Background(), pool, logger, []string{"up"}); err != nil {
+			logger.Error("migration failed", "error", err)
+			os.Exit(1)
+		}
+	}
+
 	uow := services.NewPostgresUnitOfWork(pool)
 	eventBus := eventbus.NewEventBus(logger)
+	eventBus.SetHandlerTimeout(config.Events.HandlerTimeout)
+
+	client := telegram.NewClient(&config.Telegram, logger)
+	clock := clockwork.NewRealClock()
+
+	deadLetters := services.NewDeadLetters(eventBus, logger, uow, clock)
+	telegramService := services.NewTelegramService(eventBus, client, &config.Telegram, logger, uow, clock)
+	services.NewDutyService(eventBus, client, &config.Telegram, logger, uow, clock)
+
+	if len(os.Args) > 1 && os.Args[1] == "dead-letters" {
+		err := runDeadLetters(context.Background(), deadLetters, os.Args[2:])
 
-	services.NewTelegramService(eventBus, &config.Telegram, logger, uow)
-	services.NewDutyService(eventBus, &config.Telegram, logger, uow)
+		// replayed handlers may have published events of their own
+		closeCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
 
-	s, err := scheduler.New(eventBus, logger, uow)
+		if err := eventBus.Close(closeCtx); err != nil {
+			logger.Error("event handlers didn't finish in time", "error", err)
+		}
+
+		if err != nil {
+			logger.Error("dead letters command failed", "error", err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	s, err := scheduler.New(eventBus, &config.Scheduler, logger, uow, clock)
 	if err != nil {
 		panic(err)
 	}
 
 	s.Start()
-	defer s.Shutdown()
 
-	server := server.NewServer(config.Server, config.Telegram, logger, eventBus)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	dispatcherDone := make(chan struct{})
+	go func() {
+		defer close(dispatcherDone)
+		services.NewOutboxDispatcher(eventBus, logger, uow, clock).Run(ctx)
+	}()
+
+	if err := telegramService.PublishCommands(ctx); err != nil {
+		logger.Error("couldn't publish bot commands", "error", err)
+	}
+
+	pollingDone := make(chan struct{})
+
+	switch config.Telegram.UpdateMode {
+	case "polling":
+		if err := client.DeleteWebhook().Execute(ctx); err != nil {
+			logger.Error("couldn't delete webhook", "error", err)
+		}
+
+		go func() {
+			defer close(pollingDone)
+			client.PollUpdates(ctx, eventBus, events.TelegramUpdate)
+		}()
+	case "webhook":
+		close(pollingDone)
+		registerWebhook(ctx, client, config, logger)
+	}
+
+	httpServer := &http.Server{
+		Addr:    ":" + config.Server.Port,
+		Handler: server.NewServer(config.Server, config.Telegram, logger, eventBus),
+	}
 
 	logger.Info(fmt.Sprintf("starting server on port %s", config.Server.Port))
 
-	if err := http.ListenAndServe(":"+config.Server.Port, server); err != nil {
-		logger.Error("server failed to start")
-		os.Exit(1)
+	go func() {
+		if err := httpServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("server failed to start", "error", err)
+			os.Exit(1)
+		}
+	}()
+
+	<-ctx.Done()
+	logger.Info("shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	// stop taking in new work first, then let the started work finish
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		logger.Error("couldn't shut down the server", "error", err)
+	}
+
+	<-pollingDone
+	<-dispatcherDone
+
+	// handlers schedule reminders, so the scheduler stops after they finish
+	if err := eventBus.Close(shutdownCtx); err != nil {
+		logger.Error("event handlers didn't finish in time", "error", err)
+	}
+
+	s.Shutdown()
+}
+
+func registerWebhook(
+	ctx context.Context,
+	client *telegram.Client,
+	config *config.Config,
+	logger *slog.Logger,
+) {
+	if config.Server.PublicURL == "" {
+		logger.Warn("public url is not set, skipping webhook registration")
+		return
+	}
+
+	url := config.Server.PublicURL + "/telegram/" + config.Server.TelegramRouteSecret
+
+	err := client.SetWebhook(url).
+		WithSecretToken(config.Telegram.HeaderSecret).
+		WithAllowedUpdates("message", "callback_query").
+		Execute(ctx)
+	if err != nil {
+		logger.Error("couldn't register webhook", "error", err)
+		return
+	}
+
+	info, err := client.GetWebhookInfo(ctx)
+	if err != nil {
+		logger.Error("couldn't get webhook info", "error", err)
+		return
+	}
+
+	logger.Info(
+		"webhook registered",
+		"pending_update_count", info.PendingUpdateCount,
+		"last_error_message", info.LastErrorMessage,
+	)
+}
+
+// runMigrations handles `app migrate [up|down|status]`
+func runMigrations(
+	ctx context.Context,
+	pool *pgxpool.Pool,
+	logger *slog.Logger,
+	args []string,
+) error {
+	migrator, err := migrations.New(pool, logger)
+	if err != nil {
+		return err
+	}
+
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		return migrator.Up(ctx)
+	case "down":
+		return migrator.Down(ctx)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, s := range statuses {
+			appliedAt := "pending"
+			if s.AppliedAt != nil {
+				appliedAt = s.AppliedAt.Format(time.RFC3339)
+			}
+
+			fmt.Printf("%04d_%s\t%s\n", s.Migration.Version, s.Migration.Name, appliedAt)
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command %q, use up, down or status", command)
+	}
+}
+
+// deadLettersLimit is how many dead letters `app dead-letters list` shows
+const deadLettersLimit = 100
+
+// runDeadLetters handles `app dead-letters [list|replay <id>]`
+func runDeadLetters(
+	ctx context.Context,
+	deadLetters *services.DeadLetters,
+	args []string,
+) error {
+	command := "list"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "list":
+		letters, err := deadLetters.Pending(ctx, deadLettersLimit)
+		if err != nil {
+			return err
+		}
+
+		for _, dl := range letters {
+			fmt.Printf(
+				"%d\t%s\t%s\t%s\t%d attempts\t%s\t%s\n",
+				dl.ID,
+				dl.FailedAt.Format(time.RFC3339),
+				dl.EventType,
+				dl.Subscriber,
+				dl.Attempts,
+				dl.Error,
+				dl.Payload,
+			)
+		}
+
+		return nil
+	case "replay":
+		if len(args) < 2 {
+			return errors.New("dead letter id is missing, use replay <id>")
+		}
+
+		id, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid dead letter id %q: %w", args[1], err)
+		}
+
+		err = deadLetters.Replay(ctx, id)
+
+		// the scheduler doesn't run in this command, its jobs and reminders
+		// are rebuilt by the running app's reconciliation instead
+		if errors.Is(err, eventbus.ErrSubscriberNotFound) {
+			return fmt.Errorf("%w, scheduler's dead letters aren't replayed, the app reconciles its jobs", err)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("replayed dead letter %d\n", id)
+		return nil
+	default:
+		return fmt.Errorf("unknown dead-letters command %q, use list or replay", command)
 	}
 }
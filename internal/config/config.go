@@ -6,32 +6,49 @@ import (
 	"log/slog"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
 type Config struct {
-	LogLevel slog.Level
-	Server   ServerConfig
-	Database DatabaseConfig
-	Telegram TelegramConfig
+	LogLevel  slog.Level
+	Server    ServerConfig
+	Database  DatabaseConfig
+	Telegram  TelegramConfig
+	Scheduler SchedulerConfig
+	Events    EventsConfig
 }
 
 type ServerConfig struct {
 	Port                string
 	MaxLoggedBodySize   int
+	PublicURL           string
 	TelegramRouteSecret string
 }
 
 type DatabaseConfig struct {
-	URL string
+	URL         string
+	AutoMigrate bool
 }
 
 type TelegramConfig struct {
-	APIToken     string
-	BaseURL      string
-	BotID        int64
-	HeaderSecret string
-	Timeout      time.Duration
+	APIToken       string
+	BaseURL        string
+	BotID          int64
+	HeaderSecret   string
+	Timeout        time.Duration
+	MaxRetries     int
+	UpdateMode     string
+	PollingTimeout time.Duration
+}
+
+type SchedulerConfig struct {
+	MaxLateness       time.Duration
+	ReconcileInterval time.Duration
+}
+
+type EventsConfig struct {
+	HandlerTimeout time.Duration
 }
 
 func NewConfig() (*Config, error) {
@@ -44,11 +61,21 @@ func NewConfig() (*Config, error) {
 		},
 		Database: DatabaseConfig{},
 		Telegram: TelegramConfig{
-			APIToken:     "token",
-			BaseURL:      "https://api.telegram.org",
-			BotID:        0,
-			HeaderSecret: "secret",
-			Timeout:      30 * time.Second,
+			APIToken:       "token",
+			BaseURL:        "https://api.telegram.org",
+			BotID:          0,
+			HeaderSecret:   "secret",
+			Timeout:        30 * time.Second,
+			MaxRetries:     3,
+			UpdateMode:     "webhook",
+			PollingTimeout: 25 * time.Second,
+		},
+		Scheduler: SchedulerConfig{
+			MaxLateness:       12 * time.Hour,
+			ReconcileInterval: 5 * time.Minute,
+		},
+		Events: EventsConfig{
+			HandlerTimeout: 2 * time.Minute,
 		},
 	}
 
@@ -83,6 +110,10 @@ func NewConfig() (*Config, error) {
 		config.Server.MaxLoggedBodySize = i
 	}
 
+	if v := os.Getenv("SERVER_PUBLIC_URL"); v != "" {
+		config.Server.PublicURL = strings.TrimSuffix(v, "/")
+	}
+
 	if v := os.Getenv("SERVER_TELEGRAM_ROUTE_SECRET"); v != "" {
 		config.Server.TelegramRouteSecret = v
 	}
@@ -91,6 +122,15 @@ func NewConfig() (*Config, error) {
 		config.Database.URL = v
 	}
 
+	if v := os.Getenv("DATABASE_AUTO_MIGRATE"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			log.Fatalf("invalid config param DATABASE_AUTO_MIGRATE: %v", err)
+		}
+
+		config.Database.AutoMigrate = b
+	}
+
 	if v := os.Getenv("TELEGRAM_API_TOKEN"); v != "" {
 		config.Telegram.APIToken = v
 	}
@@ -121,5 +161,68 @@ func NewConfig() (*Config, error) {
 		config.Telegram.Timeout = time.Duration(i) * time.Second
 	}
 
+	if v := os.Getenv("TELEGRAM_MAX_RETRIES"); v != "" {
+		i, err := strconv.Atoi(v)
+		if err != nil {
+			log.Fatalf("invalid config param TELEGRAM_MAX_RETRIES: %v", err)
+		}
+
+		config.Telegram.MaxRetries = i
+	}
+
+	if v := os.Getenv("TELEGRAM_UPDATE_MODE"); v != "" {
+		if v != "webhook" && v != "polling" {
+			log.Fatalf("invalid config param TELEGRAM_UPDATE_MODE: %s", v)
+		}
+
+		config.Telegram.UpdateMode = v
+	}
+
+	if v := os.Getenv("TELEGRAM_POLLING_TIMEOUT"); v != "" {
+		i, err := strconv.Atoi(v)
+		if err != nil {
+			log.Fatalf("invalid config param TELEGRAM_POLLING_TIMEOUT: %v", err)
+		}
+
+		config.Telegram.PollingTimeout = time.Duration(i) * time.Second
+	}
+
+	// long polling holds the request open for PollingTimeout, the client
+	// would give up on every poll otherwise
+	if config.Telegram.UpdateMode == "polling" && config.Telegram.Timeout <= config.Telegram.PollingTimeout {
+		log.Fatalf(
+			"invalid config param TELEGRAM_TIMEOUT: %s must be longer than TELEGRAM_POLLING_TIMEOUT %s",
+			config.Telegram.Timeout,
+			config.Telegram.PollingTimeout,
+		)
+	}
+
+	if v := os.Getenv("SCHEDULER_MAX_LATENESS"); v != "" {
+		i, err := strconv.Atoi(v)
+		if err != nil {
+			log.Fatalf("invalid config param SCHEDULER_MAX_LATENESS: %v", err)
+		}
+
+		config.Scheduler.MaxLateness = time.Duration(i) * time.Hour
+	}
+
+	if v := os.Getenv("SCHEDULER_RECONCILE_INTERVAL"); v != "" {
+		i, err := strconv.Atoi(v)
+		if err != nil {
+			log.Fatalf("invalid config param SCHEDULER_RECONCILE_INTERVAL: %v", err)
+		}
+
+		config.Scheduler.ReconcileInterval = time.Duration(i) * time.Minute
+	}
+
+	if v := os.Getenv("EVENTS_HANDLER_TIMEOUT"); v != "" {
+		i, err := strconv.Atoi(v)
+		if err != nil {
+			log.Fatalf("invalid config param EVENTS_HANDLER_TIMEOUT: %v", err)
+		}
+
+		config.Events.HandlerTimeout = time.Duration(i) * time.Second
+	}
+
 	return config, nil
 }
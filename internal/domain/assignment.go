@@ -0,0 +1,114 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrNotAssignee          = errors.New("member is not assigned to this duty")
+	ErrItemNotFound         = errors.New("checklist item not found")
+	ErrItemAlreadyCompleted = errors.New("checklist item is already completed")
+)
+
+// Assignment is a single duty cycle of a household member,
+// it tracks the completion of the household's checklist
+type Assignment struct {
+	ID          int64
+	HouseholdID int64
+	MemberID    int64
+	CreatedAt   time.Time
+	Items       []*AssignmentItem
+}
+
+// Reminder is a follow-up on an assignment that may still be unfinished
+type Reminder struct {
+	AssignmentID int64
+	HouseholdID  int64
+	At           time.Time
+	Escalate     bool
+}
+
+type AssignmentItem struct {
+	Position    int
+	Name        string
+	CompletedBy int64
+	CompletedAt *time.Time
+}
+
+func NewAssignment(h *Household, m *Member, createdAt time.Time) *Assignment {
+	items := make([]*AssignmentItem, len(h.Checklist))
+	for i, name := range h.Checklist {
+		items[i] = &AssignmentItem{Position: i, Name: name}
+	}
+
+	return &Assignment{
+		HouseholdID: h.TelegramID,
+		MemberID:    m.TelegramID,
+		CreatedAt:   createdAt,
+		Items:       items,
+	}
+}
+
+// Reminders returns the follow-ups configured by the household's deadlines
+func (a *Assignment) Reminders(h *Household) []Reminder {
+	if len(a.Items) == 0 {
+		return nil
+	}
+
+	var reminders []Reminder
+
+	if h.ReminderDelay > 0 {
+		reminders = append(reminders, Reminder{
+			AssignmentID: a.ID,
+			HouseholdID:  a.HouseholdID,
+			At:           a.CreatedAt.Add(h.ReminderDelay),
+		})
+	}
+
+	if h.EscalationDelay > 0 {
+		reminders = append(reminders, Reminder{
+			AssignmentID: a.ID,
+			HouseholdID:  a.HouseholdID,
+			At:           a.CreatedAt.Add(h.EscalationDelay),
+			Escalate:     true,
+		})
+	}
+
+	return reminders
+}
+
+func (i *AssignmentItem) IsCompleted() bool {
+	return i.CompletedAt != nil
+}
+
+// CompleteItem marks a checklist item as done by the member on duty
+func (a *Assignment) CompleteItem(position int, memberID int64, at time.Time) error {
+	if memberID != a.MemberID {
+		return ErrNotAssignee
+	}
+
+	if position < 0 || position >= len(a.Items) {
+		return ErrItemNotFound
+	}
+
+	item := a.Items[position]
+	if item.IsCompleted() {
+		return ErrItemAlreadyCompleted
+	}
+
+	item.CompletedBy = memberID
+	item.CompletedAt = &at
+
+	return nil
+}
+
+func (a *Assignment) IsCompleted() bool {
+	for _, item := range a.Items {
+		if !item.IsCompleted() {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,110 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCompleteItem(t *testing.T) {
+	h := NewHousehold(-1234567898765)
+	h.Checklist = []string{"dishes", "floor"}
+
+	alice := &Member{Name: "Alice", TelegramID: 1}
+	bob := &Member{Name: "Bob", TelegramID: 2}
+	h.AddMember(alice)
+	h.AddMember(bob)
+
+	now := time.Date(2025, 1, 4, 9, 0, 0, 0, time.UTC)
+	a := NewAssignment(h, alice, now)
+
+	if gotLen := len(a.Items); gotLen != 2 {
+		t.Fatalf("assignment has %d items, want %d", gotLen, 2)
+	}
+
+	if a.IsCompleted() {
+		t.Fatal("new assignment is completed")
+	}
+
+	if err := a.CompleteItem(0, bob.TelegramID, now); err != ErrNotAssignee {
+		t.Errorf("got error %v, want %v", err, ErrNotAssignee)
+	}
+
+	if err := a.CompleteItem(2, alice.TelegramID, now); err != ErrItemNotFound {
+		t.Errorf("got error %v, want %v", err, ErrItemNotFound)
+	}
+
+	if err := a.CompleteItem(0, alice.TelegramID, now); err != nil {
+		t.Fatalf("CompleteItem() returned an error: %v", err)
+	}
+
+	if item := a.Items[0]; item.CompletedBy != alice.TelegramID || !item.CompletedAt.Equal(now) {
+		t.Errorf("item completed by %d at %v, want %d at %v", item.CompletedBy, item.CompletedAt, alice.TelegramID, now)
+	}
+
+	if err := a.CompleteItem(0, alice.TelegramID, now); err != ErrItemAlreadyCompleted {
+		t.Errorf("got error %v, want %v", err, ErrItemAlreadyCompleted)
+	}
+
+	if a.IsCompleted() {
+		t.Fatal("assignment is completed with one item left")
+	}
+
+	if err := a.CompleteItem(1, alice.TelegramID, now); err != nil {
+		t.Fatalf("CompleteItem() returned an error: %v", err)
+	}
+
+	if !a.IsCompleted() {
+		t.Fatal("assignment is not completed after all items were done")
+	}
+}
+
+func TestReminders(t *testing.T) {
+	h := NewHousehold(-1234567898765)
+	h.Checklist = []string{"dishes"}
+
+	alice := &Member{Name: "Alice", TelegramID: 1}
+	h.AddMember(alice)
+
+	now := time.Date(2025, 1, 4, 9, 0, 0, 0, time.UTC)
+	a := NewAssignment(h, alice, now)
+	a.ID = 42
+
+	if got := a.Reminders(h); len(got) != 0 {
+		t.Fatalf("got %d reminders with no deadlines, want %d", len(got), 0)
+	}
+
+	if err := h.SetDeadlines(4*time.Hour, 24*time.Hour); err != nil {
+		t.Fatalf("SetDeadlines() returned an error: %v", err)
+	}
+
+	got := a.Reminders(h)
+	if len(got) != 2 {
+		t.Fatalf("got %d reminders, want %d", len(got), 2)
+	}
+
+	if got[0].Escalate || !got[0].At.Equal(now.Add(4*time.Hour)) || got[0].AssignmentID != 42 {
+		t.Errorf("got first reminder %v, want a reminder at %v", got[0], now.Add(4*time.Hour))
+	}
+
+	if !got[1].Escalate || !got[1].At.Equal(now.Add(24*time.Hour)) {
+		t.Errorf("got second reminder %v, want an escalation at %v", got[1], now.Add(24*time.Hour))
+	}
+
+	if err := h.SetDeadlines(0, 24*time.Hour); err != nil {
+		t.Fatalf("SetDeadlines() returned an error: %v", err)
+	}
+
+	if got := a.Reminders(h); len(got) != 1 || !got[0].Escalate {
+		t.Errorf("got reminders %v, want a single escalation", got)
+	}
+
+	h.Checklist = []string{}
+	if got := a.Reminders(h); len(got) != 1 {
+		t.Errorf("got %d reminders, want reminders to depend on assignment items", len(got))
+	}
+
+	empty := NewAssignment(h, alice, now)
+	if got := empty.Reminders(h); len(got) != 0 {
+		t.Errorf("got %d reminders for an empty checklist, want %d", len(got), 0)
+	}
+}
@@ -1,12 +1,46 @@
 // Package domain
 package domain
 
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotEnoughMembers = errors.New("not enough members in household")
+	ErrNobodyOnDuty     = errors.New("nobody is on duty")
+	ErrInvalidDeadlines = errors.New("escalation must come after the reminder")
+)
+
 type Household struct {
 	Checklist     []string
 	Crontab       string
 	CurrentMember int
 	Members       []*Member
 	TelegramID    int64
+	TimeZone      string
+
+	// ReminderDelay is how long after the notification the member on duty
+	// is pinged again if the checklist isn't finished, zero disables it
+	ReminderDelay time.Duration
+	// EscalationDelay is how long after the notification the whole household
+	// is pinged if the checklist isn't finished, zero disables it
+	EscalationDelay time.Duration
+
+	// LastNotifiedAt is when the household was last told who's on duty,
+	// nil if it never was
+	LastNotifiedAt *time.Time
+	// OnDutyID is the telegram id of the member on duty, zero if nobody is
+	OnDutyID int64
+}
+
+// Occurrence is a single scheduled notification of a household
+type Occurrence struct {
+	HouseholdID int64
+	ScheduledAt time.Time
 }
 
 func NewHousehold(telegramID int64) *Household {
@@ -16,33 +50,194 @@ func NewHousehold(telegramID int64) *Household {
 		CurrentMember: 0,
 		Members:       []*Member{},
 		TelegramID:    telegramID,
+		TimeZone:      "UTC",
 	}
 }
 
+// CronSpec returns the crontab prefixed with the household's time zone
+func (h *Household) CronSpec() string {
+	if h.TimeZone == "" {
+		return h.Crontab
+	}
+
+	return fmt.Sprintf("CRON_TZ=%s %s", h.TimeZone, h.Crontab)
+}
+
+func (h *Household) SetDeadlines(reminder, escalation time.Duration) error {
+	if reminder < 0 || escalation < 0 {
+		return ErrInvalidDeadlines
+	}
+
+	if reminder > 0 && escalation > 0 && escalation <= reminder {
+		return ErrInvalidDeadlines
+	}
+
+	h.ReminderDelay = reminder
+	h.EscalationDelay = escalation
+
+	return nil
+}
+
 func (h *Household) AddMember(m *Member) {
 	m.Order = len(h.Members)
 	h.Members = append(h.Members, m)
 }
 
-func (h *Household) RemoveMember(telegramID int64) {
+// RemoveMember removes a member from the rotation, keeping the cursor
+// pointed at the same next member. A member on duty leaves nobody on duty.
+// Returns nil if there is no such member
+func (h *Household) RemoveMember(telegramID int64) *Member {
 	for i, m := range h.Members {
-		if telegramID == m.TelegramID {
-			h.Members = append(h.Members[:i], h.Members[i+1:]...)
-			return
+		if telegramID != m.TelegramID {
+			continue
+		}
+
+		h.Members = append(h.Members[:i], h.Members[i+1:]...)
+		for j := i; j < len(h.Members); j++ {
+			h.Members[j].Order = j
+		}
+
+		if i < h.CurrentMember {
+			h.CurrentMember--
+		}
+
+		if len(h.Members) == 0 {
+			h.CurrentMember = 0
+		} else {
+			h.CurrentMember %= len(h.Members)
+		}
+
+		if h.OnDutyID == telegramID {
+			h.OnDutyID = 0
+		}
+
+		return m
+	}
+
+	return nil
+}
+
+func (h *Household) FindMember(telegramID int64) *Member {
+	for _, m := range h.Members {
+		if m.TelegramID == telegramID {
+			return m
 		}
 	}
+
+	return nil
+}
+
+func (h *Household) FindMemberByUsername(username string) *Member {
+	for _, m := range h.Members {
+		if m.Username != "" && strings.EqualFold(m.Username, username) {
+			return m
+		}
+	}
+
+	return nil
 }
 
+// PopCurrentMember puts the next member on duty and advances the cursor
 func (h *Household) PopCurrentMember() *Member {
 	m := h.Members[h.CurrentMember]
 	h.CurrentMember++
 	h.CurrentMember %= len(h.Members)
 
+	h.OnDutyID = m.TelegramID
+
 	return m
 }
 
+// OnDutyMember returns the member that is currently on duty. It is nil until
+// the household is notified for the first time and after the member leaves
+func (h *Household) OnDutyMember() *Member {
+	if h.OnDutyID == 0 {
+		return nil
+	}
+
+	return h.FindMember(h.OnDutyID)
+}
+
+// SkipCurrentMember passes the duty from the member on duty to the next one.
+// If requeue is true, the skipped member swaps places with their replacement,
+// so they take the next slot in the rotation instead of escaping their turn
+func (h *Household) SkipCurrentMember(requeue bool) (skipped *Member, next *Member, err error) {
+	if len(h.Members) < 2 {
+		return nil, nil, ErrNotEnoughMembers
+	}
+
+	skipped = h.OnDutyMember()
+	if skipped == nil {
+		return nil, nil, ErrNobodyOnDuty
+	}
+
+	// a reordered rotation can have the skipped member up next,
+	// they can't replace themselves
+	if h.Members[h.CurrentMember] == skipped {
+		h.CurrentMember++
+		h.CurrentMember %= len(h.Members)
+	}
+
+	if requeue {
+		skippedIndex := slices.Index(h.Members, skipped)
+		h.swapMembers(skippedIndex, h.CurrentMember)
+
+		next = h.Members[skippedIndex]
+		h.OnDutyID = next.TelegramID
+
+		return skipped, next, nil
+	}
+
+	next = h.PopCurrentMember()
+	return skipped, next, nil
+}
+
+// MoveMember moves a member by offset positions in the rotation,
+// keeping the cursor pointed at the same next member and the member on duty.
+// Returns false if the member can't be moved that far
+func (h *Household) MoveMember(telegramID int64, offset int) bool {
+	from := -1
+	for i, m := range h.Members {
+		if m.TelegramID == telegramID {
+			from = i
+			break
+		}
+	}
+
+	to := from + offset
+	if from < 0 || to < 0 || to >= len(h.Members) || offset == 0 {
+		return false
+	}
+
+	next := h.Members[h.CurrentMember]
+
+	step := 1
+	if offset < 0 {
+		step = -1
+	}
+
+	for i := from; i != to; i += step {
+		h.swapMembers(i, i+step)
+	}
+
+	for i, m := range h.Members {
+		if m == next {
+			h.CurrentMember = i
+			break
+		}
+	}
+
+	return true
+}
+
+func (h *Household) swapMembers(i, j int) {
+	h.Members[i], h.Members[j] = h.Members[j], h.Members[i]
+	h.Members[i].Order, h.Members[j].Order = h.Members[j].Order, h.Members[i].Order
+}
+
 type Member struct {
 	Name       string
+	Username   string
 	TelegramID int64
 	Order      int
 }
@@ -1,6 +1,10 @@
 package domain
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+	"time"
+)
 
 func TestAddMember(t *testing.T) {
 	h := NewHousehold(-1234567898765)
@@ -88,3 +92,427 @@ func TestPopCurrentMember(t *testing.T) {
 		t.Fatalf("popped %v, want %v", gotCurrent, alice)
 	}
 }
+
+func TestSkipCurrentMember(t *testing.T) {
+	newHousehold := func() *Household {
+		h := NewHousehold(-1234567898765)
+
+		h.AddMember(&Member{Name: "Alice", TelegramID: 1})
+		h.AddMember(&Member{Name: "Bob", TelegramID: 2})
+		h.AddMember(&Member{Name: "Charlie", TelegramID: 3})
+
+		return h
+	}
+
+	// notify pops the next member like a notification does
+	notify := func(h *Household) {
+		h.PopCurrentMember()
+	}
+
+	t.Run("advance", func(t *testing.T) {
+		h := newHousehold()
+		notify(h) // alice is on duty
+
+		skipped, next, err := h.SkipCurrentMember(false)
+		if err != nil {
+			t.Fatalf("SkipCurrentMember() returned an error: %v", err)
+		}
+
+		if skipped.Name != "Alice" || next.Name != "Bob" {
+			t.Fatalf("skipped %s for %s, want Alice for Bob", skipped.Name, next.Name)
+		}
+
+		if got := h.OnDutyMember(); got.Name != "Bob" {
+			t.Fatalf("%s is on duty, want Bob", got.Name)
+		}
+
+		if got := h.PopCurrentMember(); got.Name != "Charlie" {
+			t.Fatalf("popped %s, want Charlie", got.Name)
+		}
+	})
+
+	t.Run("advance with wrap-around", func(t *testing.T) {
+		h := newHousehold()
+		notify(h)
+		notify(h)
+		notify(h) // charlie is on duty
+
+		skipped, next, err := h.SkipCurrentMember(false)
+		if err != nil {
+			t.Fatalf("SkipCurrentMember() returned an error: %v", err)
+		}
+
+		if skipped.Name != "Charlie" || next.Name != "Alice" {
+			t.Fatalf("skipped %s for %s, want Charlie for Alice", skipped.Name, next.Name)
+		}
+
+		if h.CurrentMember != 1 {
+			t.Fatalf("current member index is %d, want %d", h.CurrentMember, 1)
+		}
+	})
+
+	t.Run("requeue", func(t *testing.T) {
+		h := newHousehold()
+		notify(h) // alice is on duty
+
+		skipped, next, err := h.SkipCurrentMember(true)
+		if err != nil {
+			t.Fatalf("SkipCurrentMember() returned an error: %v", err)
+		}
+
+		if skipped.Name != "Alice" || next.Name != "Bob" {
+			t.Fatalf("skipped %s for %s, want Alice for Bob", skipped.Name, next.Name)
+		}
+
+		if got := h.OnDutyMember(); got.Name != "Bob" {
+			t.Fatalf("%s is on duty, want Bob", got.Name)
+		}
+
+		if got := h.PopCurrentMember(); got.Name != "Alice" {
+			t.Fatalf("popped %s, want Alice", got.Name)
+		}
+
+		if got := h.PopCurrentMember(); got.Name != "Charlie" {
+			t.Fatalf("popped %s, want Charlie", got.Name)
+		}
+
+		for i, m := range h.Members {
+			if m.Order != i {
+				t.Errorf("%s has order %d, want %d", m.Name, m.Order, i)
+			}
+		}
+	})
+
+	t.Run("requeue with wrap-around", func(t *testing.T) {
+		h := newHousehold()
+		notify(h)
+		notify(h)
+		notify(h) // charlie is on duty
+
+		skipped, next, err := h.SkipCurrentMember(true)
+		if err != nil {
+			t.Fatalf("SkipCurrentMember() returned an error: %v", err)
+		}
+
+		if skipped.Name != "Charlie" || next.Name != "Alice" {
+			t.Fatalf("skipped %s for %s, want Charlie for Alice", skipped.Name, next.Name)
+		}
+
+		if got := h.PopCurrentMember(); got.Name != "Charlie" {
+			t.Fatalf("popped %s, want Charlie", got.Name)
+		}
+
+		if got := h.PopCurrentMember(); got.Name != "Bob" {
+			t.Fatalf("popped %s, want Bob", got.Name)
+		}
+
+		if got := h.PopCurrentMember(); got.Name != "Alice" {
+			t.Fatalf("popped %s, want Alice", got.Name)
+		}
+	})
+
+	t.Run("skipped member up next", func(t *testing.T) {
+		h := newHousehold()
+		notify(h) // alice is on duty
+		h.RemoveMember(2)
+		h.RemoveMember(3) // alice is next
+		h.AddMember(&Member{Name: "Dave", TelegramID: 4})
+
+		skipped, next, err := h.SkipCurrentMember(true)
+		if err != nil {
+			t.Fatalf("SkipCurrentMember() returned an error: %v", err)
+		}
+
+		if skipped.Name != "Alice" || next.Name != "Dave" {
+			t.Fatalf("skipped %s for %s, want Alice for Dave", skipped.Name, next.Name)
+		}
+
+		if got := h.OnDutyMember(); got.Name != "Dave" {
+			t.Fatalf("%s is on duty, want Dave", got.Name)
+		}
+
+		if got := h.PopCurrentMember(); got.Name != "Alice" {
+			t.Fatalf("popped %s, want Alice", got.Name)
+		}
+	})
+
+	t.Run("nobody on duty", func(t *testing.T) {
+		h := newHousehold()
+
+		if got := h.OnDutyMember(); got != nil {
+			t.Fatalf("%s is on duty before the first notification", got.Name)
+		}
+
+		if _, _, err := h.SkipCurrentMember(true); err != ErrNobodyOnDuty {
+			t.Fatalf("got error %v, want %v", err, ErrNobodyOnDuty)
+		}
+
+		if h.CurrentMember != 0 {
+			t.Fatalf("current member index is %d, want %d", h.CurrentMember, 0)
+		}
+	})
+
+	t.Run("not enough members", func(t *testing.T) {
+		h := NewHousehold(-1234567898765)
+		h.AddMember(&Member{Name: "Alice", TelegramID: 1})
+
+		if _, _, err := h.SkipCurrentMember(false); err != ErrNotEnoughMembers {
+			t.Fatalf("got error %v, want %v", err, ErrNotEnoughMembers)
+		}
+	})
+}
+
+func TestRemoveMemberKeepsRotation(t *testing.T) {
+	newHousehold := func() *Household {
+		h := NewHousehold(-1234567898765)
+
+		h.AddMember(&Member{Name: "Alice", TelegramID: 1})
+		h.AddMember(&Member{Name: "Bob", TelegramID: 2})
+		h.AddMember(&Member{Name: "Charlie", TelegramID: 3})
+		h.AddMember(&Member{Name: "Dave", TelegramID: 4})
+
+		return h
+	}
+
+	t.Run("before cursor", func(t *testing.T) {
+		h := newHousehold()
+		h.CurrentMember = 2 // charlie is next
+
+		if removed := h.RemoveMember(1); removed == nil || removed.Name != "Alice" {
+			t.Fatalf("removed %v, want Alice", removed)
+		}
+
+		if got := h.PopCurrentMember(); got.Name != "Charlie" {
+			t.Fatalf("popped %s, want Charlie", got.Name)
+		}
+
+		for i, m := range h.Members {
+			if m.Order != i {
+				t.Errorf("%s has order %d, want %d", m.Name, m.Order, i)
+			}
+		}
+	})
+
+	t.Run("at cursor", func(t *testing.T) {
+		h := newHousehold()
+		h.CurrentMember = 1 // bob is next
+
+		h.RemoveMember(2)
+
+		if got := h.PopCurrentMember(); got.Name != "Charlie" {
+			t.Fatalf("popped %s, want Charlie", got.Name)
+		}
+	})
+
+	t.Run("after cursor", func(t *testing.T) {
+		h := newHousehold()
+		h.CurrentMember = 1 // bob is next
+
+		h.RemoveMember(4)
+
+		if got := h.PopCurrentMember(); got.Name != "Bob" {
+			t.Fatalf("popped %s, want Bob", got.Name)
+		}
+	})
+
+	t.Run("last member at cursor", func(t *testing.T) {
+		h := newHousehold()
+		h.CurrentMember = 3 // dave is next
+
+		h.RemoveMember(4)
+
+		if h.CurrentMember != 0 {
+			t.Fatalf("current member index is %d, want %d", h.CurrentMember, 0)
+		}
+
+		if got := h.PopCurrentMember(); got.Name != "Alice" {
+			t.Fatalf("popped %s, want Alice", got.Name)
+		}
+	})
+
+	t.Run("everyone", func(t *testing.T) {
+		h := newHousehold()
+		h.CurrentMember = 3
+
+		for _, id := range []int64{4, 3, 2, 1} {
+			h.RemoveMember(id)
+		}
+
+		if h.CurrentMember != 0 {
+			t.Fatalf("current member index is %d, want %d", h.CurrentMember, 0)
+		}
+	})
+
+	t.Run("on duty", func(t *testing.T) {
+		h := newHousehold()
+		h.PopCurrentMember() // alice is on duty
+
+		h.RemoveMember(1)
+
+		if got := h.OnDutyMember(); got != nil {
+			t.Fatalf("%s is on duty, want nobody", got.Name)
+		}
+
+		if got := h.PopCurrentMember(); got.Name != "Bob" {
+			t.Fatalf("popped %s, want Bob", got.Name)
+		}
+	})
+
+	t.Run("not on duty", func(t *testing.T) {
+		h := newHousehold()
+		h.PopCurrentMember() // alice is on duty
+
+		h.RemoveMember(3)
+
+		if got := h.OnDutyMember(); got == nil || got.Name != "Alice" {
+			t.Fatalf("%v is on duty, want Alice", got)
+		}
+	})
+
+	t.Run("unknown member", func(t *testing.T) {
+		h := newHousehold()
+
+		if removed := h.RemoveMember(42); removed != nil {
+			t.Fatalf("removed %v, want nil", removed)
+		}
+
+		if gotLen := len(h.Members); gotLen != 4 {
+			t.Fatalf("members list has length %d, want %d", gotLen, 4)
+		}
+	})
+}
+
+func TestMoveMember(t *testing.T) {
+	newHousehold := func() *Household {
+		h := NewHousehold(-1234567898765)
+
+		h.AddMember(&Member{Name: "Alice", TelegramID: 1})
+		h.AddMember(&Member{Name: "Bob", TelegramID: 2})
+		h.AddMember(&Member{Name: "Charlie", TelegramID: 3})
+
+		return h
+	}
+
+	names := func(h *Household) []string {
+		var result []string
+		for _, m := range h.Members {
+			result = append(result, m.Name)
+		}
+		return result
+	}
+
+	t.Run("up", func(t *testing.T) {
+		h := newHousehold()
+		h.CurrentMember = 1 // bob is next
+
+		if !h.MoveMember(3, -1) {
+			t.Fatal("MoveMember() returned false, want true")
+		}
+
+		if got := names(h); !reflect.DeepEqual(got, []string{"Alice", "Charlie", "Bob"}) {
+			t.Fatalf("got order %v, want [Alice Charlie Bob]", got)
+		}
+
+		if got := h.PopCurrentMember(); got.Name != "Bob" {
+			t.Fatalf("popped %s, want Bob", got.Name)
+		}
+
+		for i, m := range h.Members {
+			if m.Order != i {
+				t.Errorf("%s has order %d, want %d", m.Name, m.Order, i)
+			}
+		}
+	})
+
+	t.Run("down by two", func(t *testing.T) {
+		h := newHousehold()
+
+		if !h.MoveMember(1, 2) {
+			t.Fatal("MoveMember() returned false, want true")
+		}
+
+		if got := names(h); !reflect.DeepEqual(got, []string{"Bob", "Charlie", "Alice"}) {
+			t.Fatalf("got order %v, want [Bob Charlie Alice]", got)
+		}
+
+		if got := h.PopCurrentMember(); got.Name != "Alice" {
+			t.Fatalf("popped %s, want Alice", got.Name)
+		}
+	})
+
+	t.Run("keeps member on duty", func(t *testing.T) {
+		h := newHousehold()
+		h.PopCurrentMember() // alice is on duty, bob is next
+
+		if !h.MoveMember(3, -2) {
+			t.Fatal("MoveMember() returned false, want true")
+		}
+
+		if got := names(h); !reflect.DeepEqual(got, []string{"Charlie", "Alice", "Bob"}) {
+			t.Fatalf("got order %v, want [Charlie Alice Bob]", got)
+		}
+
+		if got := h.OnDutyMember(); got.Name != "Alice" {
+			t.Fatalf("%s is on duty, want Alice", got.Name)
+		}
+
+		if got := h.PopCurrentMember(); got.Name != "Bob" {
+			t.Fatalf("popped %s, want Bob", got.Name)
+		}
+	})
+
+	t.Run("out of bounds", func(t *testing.T) {
+		h := newHousehold()
+
+		if h.MoveMember(1, -1) {
+			t.Error("moved the first member up")
+		}
+
+		if h.MoveMember(3, 1) {
+			t.Error("moved the last member down")
+		}
+
+		if h.MoveMember(42, 1) {
+			t.Error("moved an unknown member")
+		}
+
+		if got := names(h); !reflect.DeepEqual(got, []string{"Alice", "Bob", "Charlie"}) {
+			t.Fatalf("got order %v, want [Alice Bob Charlie]", got)
+		}
+	})
+}
+
+func TestCronSpec(t *testing.T) {
+	h := NewHousehold(-1234567898765)
+	h.Crontab = "0 9 * * 5"
+
+	h.TimeZone = "Europe/Kyiv"
+	if got, want := h.CronSpec(), "CRON_TZ=Europe/Kyiv 0 9 * * 5"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	h.TimeZone = ""
+	if got, want := h.CronSpec(), "0 9 * * 5"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestSetDeadlines(t *testing.T) {
+	h := NewHousehold(-1234567898765)
+
+	if err := h.SetDeadlines(4*time.Hour, 2*time.Hour); err != ErrInvalidDeadlines {
+		t.Errorf("got error %v, want %v", err, ErrInvalidDeadlines)
+	}
+
+	if err := h.SetDeadlines(-time.Hour, 0); err != ErrInvalidDeadlines {
+		t.Errorf("got error %v, want %v", err, ErrInvalidDeadlines)
+	}
+
+	if err := h.SetDeadlines(4*time.Hour, 0); err != nil {
+		t.Errorf("SetDeadlines() returned an error: %v", err)
+	}
+
+	if h.ReminderDelay != 4*time.Hour || h.EscalationDelay != 0 {
+		t.Errorf("got deadlines %v and %v, want %v and %v", h.ReminderDelay, h.EscalationDelay, 4*time.Hour, 0)
+	}
+}
@@ -0,0 +1,30 @@
+package eventbus
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestLogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewLogHandler(slog.NewTextHandler(&buf, nil))).With("service", "test")
+
+	logger.InfoContext(WithEventID(context.Background(), "abc"), "with id")
+	logger.InfoContext(context.Background(), "without id")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d log lines, want 2: %q", len(lines), buf.String())
+	}
+
+	if !strings.Contains(lines[0], "event_id=abc") || !strings.Contains(lines[0], "service=test") {
+		t.Errorf("got %q, want event_id and service", lines[0])
+	}
+
+	if strings.Contains(lines[1], "event_id") {
+		t.Errorf("got %q, want no event_id", lines[1])
+	}
+}
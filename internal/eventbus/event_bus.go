@@ -3,56 +3,510 @@ package eventbus
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
 	"runtime/debug"
 	"sync"
+	"time"
 )
 
 type Event any
 type EventType string
-type Handler func(context.Context, Event)
+type Handler func(context.Context, Event) error
+
+var (
+	ErrSubscriberNotFound = errors.New("subscriber not found")
+	ErrClosed             = errors.New("event bus is closed")
+)
+
+// RetryPolicy controls how many times a failed handler is run again.
+// The zero value runs the handler once
+type RetryPolicy struct {
+	MaxAttempts int
+	// InitialBackoff is doubled after every failed attempt up to MaxBackoff,
+	// zero MaxBackoff means no limit
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// backoff returns how long to wait after the given failed attempt
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.InitialBackoff
+	for i := 1; i < attempt && (p.MaxBackoff == 0 || delay < p.MaxBackoff); i++ {
+		delay *= 2
+	}
+
+	if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+		return p.MaxBackoff
+	}
+
+	return delay
+}
+
+// DeadLetter is an event whose handler failed on every attempt
+type DeadLetter struct {
+	ID         int64
+	EventType  EventType
+	Subscriber string
+	Payload    json.RawMessage
+	Error      string
+	Attempts   int
+	FailedAt   time.Time
+}
+
+// DeadLetterStore keeps dead letters so they can be inspected and replayed
+type DeadLetterStore interface {
+	AddDeadLetter(ctx context.Context, dl DeadLetter) error
+}
+
+type SubscribeOption func(*subscription)
+
+// WithName names the subscription, dead letters are replayed to the
+// subscription with the same name
+func WithName(name string) SubscribeOption {
+	return func(s *subscription) {
+		s.name = name
+	}
+}
+
+func WithRetry(policy RetryPolicy) SubscribeOption {
+	return func(s *subscription) {
+		s.retry = policy
+	}
+}
+
+// WithTimeout limits every attempt of the handler, it overrides the bus'
+// handler timeout
+func WithTimeout(timeout time.Duration) SubscribeOption {
+	return func(s *subscription) {
+		s.timeout = timeout
+	}
+}
+
+// WithKey runs events with the same key one at a time in the order they were
+// published, events with different keys still run in parallel. Events with
+// an empty key and payloads other than T aren't ordered
+func WithKey[T any](key func(T) string) SubscribeOption {
+	return func(s *subscription) {
+		s.key = func(e Event) string {
+			payload, ok := e.(T)
+			if !ok {
+				return ""
+			}
+
+			return key(payload)
+		}
+	}
+}
+
+// withDecoder lets the subscription decode payloads of its dead letters
+func withDecoder(decode func(json.RawMessage) (Event, error)) SubscribeOption {
+	return func(s *subscription) {
+		s.decode = decode
+	}
+}
+
+type subscription struct {
+	name    string
+	handler Handler
+	retry   RetryPolicy
+	timeout time.Duration
+	decode  func(json.RawMessage) (Event, error)
+
+	// key orders events, queues hold events waiting for an earlier event
+	// with the same key. A key is in queues while its events are handled
+	key       func(Event) string
+	queueLock sync.Mutex
+	queues    map[string][]queuedEvent
+}
+
+type queuedEvent struct {
+	ctx    context.Context
+	event  Event
+	result chan<- error
+}
 
 type EventBus struct {
-	handlers map[EventType][]Handler
-	lock     sync.RWMutex
-	logger   *slog.Logger
+	handlers       map[EventType][]*subscription
+	lock           sync.RWMutex
+	logger         *slog.Logger
+	deadLetters    DeadLetterStore
+	handlerTimeout time.Duration
+
+	// running tracks handler goroutines, closed is set once Close is called
+	// and done is closed with it to cut retry backoffs short
+	running sync.WaitGroup
+	closed  bool
+	done    chan struct{}
+
+	// ctx is the parent of handler contexts, it is cancelled when Close
+	// gives up waiting for handlers
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 func NewEventBus(logger *slog.Logger) *EventBus {
+	ctx, cancel := context.WithCancel(context.Background())
+
 	return &EventBus{
-		handlers: make(map[EventType][]Handler),
+		handlers: make(map[EventType][]*subscription),
 		logger:   logger,
+		done:     make(chan struct{}),
+		ctx:      ctx,
+		cancel:   cancel,
 	}
 }
 
-func (eb *EventBus) Subscribe(eventType EventType, handler Handler) {
+// SetHandlerTimeout limits every handler attempt that doesn't have its own
+// timeout, zero means no limit
+func (eb *EventBus) SetHandlerTimeout(timeout time.Duration) {
+	eb.lock.Lock()
+	defer eb.lock.Unlock()
+
+	eb.handlerTimeout = timeout
+}
+
+// SetDeadLetterStore sets where events are kept once their handler runs out
+// of attempts. Without a store they are logged and dropped
+func (eb *EventBus) SetDeadLetterStore(store DeadLetterStore) {
 	eb.lock.Lock()
 	defer eb.lock.Unlock()
 
-	eb.handlers[eventType] = append(eb.handlers[eventType], handler)
-	eb.logger.Debug("new handler registered", "event", eventType)
+	eb.deadLetters = store
 }
 
+func (eb *EventBus) Subscribe(eventType EventType, handler Handler, opts ...SubscribeOption) {
+	s := &subscription{handler: handler}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	eb.lock.Lock()
+	defer eb.lock.Unlock()
+
+	eb.handlers[eventType] = append(eb.handlers[eventType], s)
+	eb.logger.Debug("new handler registered", "event", eventType, "subscriber", s.name)
+}
+
+// Publish runs every handler of the event in its own goroutine, handlers
+// subscribed WithKey run in order with other events of the same key.
+// Handlers get ctx's values and event id, but not its deadline or
+// cancellation, so they can outlive the publisher. Events published after
+// Close are dropped, unless they come from a handler the bus still drains
 func (eb *EventBus) Publish(ctx context.Context, eventType EventType, event Event) {
+	if _, err := eb.publish(ctx, eventType, event, false); err != nil {
+		eb.logger.WarnContext(ctx, "event published after the bus was closed, dropping it", "event", eventType)
+	}
+}
+
+// PublishAndWait runs the handlers like Publish does and waits for them.
+// It returns the errors of handlers that ran out of attempts, their events
+// aren't sent to dead letters since the caller still has them to publish
+// again. Returns ErrClosed if the bus is closed
+func (eb *EventBus) PublishAndWait(ctx context.Context, eventType EventType, event Event) error {
+	results, err := eb.publish(ctx, eventType, event, true)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for range cap(results) {
+		errs = append(errs, <-results)
+	}
+
+	return errors.Join(errs...)
+}
+
+// publish starts the handlers of the event. If wait is set, every handler
+// reports its outcome to the returned channel instead of dead letters
+func (eb *EventBus) publish(ctx context.Context, eventType EventType, event Event, wait bool) (<-chan error, error) {
+	if EventID(ctx) == "" {
+		ctx = WithEventID(ctx, NewEventID())
+	}
+
 	eb.lock.RLock()
-	handlersToCall := make([]Handler, 0, len(eb.handlers[eventType]))
+	if eb.closed && !eb.isHandlerContext(ctx) {
+		eb.lock.RUnlock()
+		return nil, ErrClosed
+	}
+
+	handlersToCall := make([]*subscription, 0, len(eb.handlers[eventType]))
 	handlersToCall = append(handlersToCall, eb.handlers[eventType]...)
+	// added while holding the lock, so Close can't start waiting in between
+	eb.running.Add(len(handlersToCall))
 	eb.lock.RUnlock()
 
-	eb.logger.Info("new event published", "event", eventType, "handlers", len(handlersToCall))
-	for _, handler := range handlersToCall {
-		go func(h Handler) {
-			defer func() {
-				if err := recover(); err != nil {
-					eb.logger.Error(
-						"panic recovered",
-						"error", err,
-						"stack", string(debug.Stack()),
-					)
-				}
-			}()
-
-			h(ctx, event)
-		}(handler)
+	var results chan error
+	if wait {
+		results = make(chan error, len(handlersToCall))
+	}
+
+	eb.logger.InfoContext(ctx, "new event published", "event", eventType, "handlers", len(handlersToCall))
+	for _, s := range handlersToCall {
+		if s.key != nil {
+			if key := s.key(event); key != "" {
+				eb.enqueue(ctx, eventType, s, key, queuedEvent{ctx: ctx, event: event, result: results})
+				continue
+			}
+		}
+
+		go func(s *subscription) {
+			defer eb.running.Done()
+			eb.deliver(ctx, eventType, s, event, results)
+		}(s)
+	}
+
+	return results, nil
+}
+
+// enqueue adds the event to its key's queue and starts draining the queue
+// unless it is drained already
+func (eb *EventBus) enqueue(ctx context.Context, eventType EventType, s *subscription, key string, event queuedEvent) {
+	s.queueLock.Lock()
+	defer s.queueLock.Unlock()
+
+	if s.queues == nil {
+		s.queues = make(map[string][]queuedEvent)
+	}
+
+	queue, draining := s.queues[key]
+	s.queues[key] = append(queue, event)
+
+	if !draining {
+		go eb.drain(eventType, s, key)
+	}
+}
+
+// drain delivers the key's events one by one until its queue is empty. The
+// event being delivered stays at the head of the queue
+func (eb *EventBus) drain(eventType EventType, s *subscription, key string) {
+	for {
+		s.queueLock.Lock()
+		next := s.queues[key][0]
+		s.queueLock.Unlock()
+
+		eb.deliver(next.ctx, eventType, s, next.event, next.result)
+
+		s.queueLock.Lock()
+		queue := s.queues[key][1:]
+		if len(queue) == 0 {
+			delete(s.queues, key)
+		} else {
+			s.queues[key] = queue
+		}
+		s.queueLock.Unlock()
+
+		eb.running.Done()
+
+		if len(queue) == 0 {
+			return
+		}
+	}
+}
+
+// deliver runs the handler until it succeeds or runs out of attempts, then
+// sends the event to the dead letter store. With a result channel the outcome
+// is sent there instead. Closing the bus stops waiting for the next attempt
+func (eb *EventBus) deliver(
+	ctx context.Context,
+	eventType EventType,
+	s *subscription,
+	event Event,
+	result chan<- error,
+) {
+	// detached from the publisher, cancelled only by the bus
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+
+	ctx = context.WithValue(ctx, handlerBusKey{}, eb)
+
+	stop := context.AfterFunc(eb.ctx, cancel)
+	defer stop()
+
+	maxAttempts := max(s.retry.MaxAttempts, 1)
+
+	var err error
+	attempt := 1
+	for ; ; attempt++ {
+		err = eb.call(ctx, s, event)
+		if err == nil {
+			break
+		}
+
+		eb.logger.ErrorContext(
+			ctx,
+			"handler failed",
+			"event", eventType,
+			"subscriber", s.name,
+			"attempt", attempt,
+			"error", err,
+		)
+
+		if attempt >= maxAttempts {
+			break
+		}
+
+		timer := time.NewTimer(s.retry.backoff(attempt))
+		select {
+		case <-timer.C:
+			continue
+		case <-eb.done:
+		case <-ctx.Done():
+		}
+
+		timer.Stop()
+		break
+	}
+
+	if result != nil {
+		result <- err
+		return
+	}
+
+	if err != nil {
+		eb.deadLetter(ctx, eventType, s, event, attempt, err)
+	}
+}
+
+// call runs the handler with its timeout and turns a panic into an error
+func (eb *EventBus) call(ctx context.Context, s *subscription, event Event) (err error) {
+	timeout := s.timeout
+	if timeout == 0 {
+		eb.lock.RLock()
+		timeout = eb.handlerTimeout
+		eb.lock.RUnlock()
+	}
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			eb.logger.ErrorContext(
+				ctx,
+				"panic recovered",
+				"error", r,
+				"stack", string(debug.Stack()),
+			)
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return s.handler(ctx, event)
+}
+
+func (eb *EventBus) deadLetter(
+	ctx context.Context,
+	eventType EventType,
+	s *subscription,
+	event Event,
+	attempts int,
+	handlerErr error,
+) {
+	eb.lock.RLock()
+	store := eb.deadLetters
+	eb.lock.RUnlock()
+
+	if store == nil {
+		eb.logger.ErrorContext(ctx, "event dropped", "event", eventType, "subscriber", s.name, "attempts", attempts)
+		return
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		eb.logger.ErrorContext(ctx, "couldn't encode dead letter payload", "event", eventType, "error", err)
+		payload = []byte("null")
+	}
+
+	// the event's context may be cancelled already, e.g. during shutdown
+	err = store.AddDeadLetter(context.WithoutCancel(ctx), DeadLetter{
+		EventType:  eventType,
+		Subscriber: s.name,
+		Payload:    payload,
+		Error:      handlerErr.Error(),
+		Attempts:   attempts,
+	})
+	if err != nil {
+		eb.logger.ErrorContext(ctx, "couldn't save a dead letter", "event", eventType, "subscriber", s.name, "error", err)
+		return
+	}
+
+	eb.logger.WarnContext(ctx, "event moved to dead letters", "event", eventType, "subscriber", s.name, "attempts", attempts)
+}
+
+// Replay runs the dead letter's subscriber once more, synchronously, and
+// returns the handler's error
+func (eb *EventBus) Replay(ctx context.Context, dl DeadLetter) error {
+	if EventID(ctx) == "" {
+		ctx = WithEventID(ctx, NewEventID())
+	}
+
+	eb.lock.RLock()
+	var s *subscription
+	for _, candidate := range eb.handlers[dl.EventType] {
+		if dl.Subscriber != "" && candidate.name == dl.Subscriber {
+			s = candidate
+			break
+		}
+	}
+	eb.lock.RUnlock()
+
+	if s == nil {
+		return fmt.Errorf("%w: %q of %s", ErrSubscriberNotFound, dl.Subscriber, dl.EventType)
+	}
+
+	if s.decode == nil {
+		return fmt.Errorf("subscriber %q can't decode dead letters", dl.Subscriber)
+	}
+
+	event, err := s.decode(dl.Payload)
+	if err != nil {
+		return fmt.Errorf("couldn't decode dead letter payload: %w", err)
+	}
+
+	return eb.call(ctx, s, event)
+}
+
+// handlerBusKey marks contexts of handlers with the bus that runs them
+type handlerBusKey struct{}
+
+// isHandlerContext reports whether ctx belongs to a handler of the bus
+func (eb *EventBus) isHandlerContext(ctx context.Context) bool {
+	bus, _ := ctx.Value(handlerBusKey{}).(*EventBus)
+	return bus == eb
+}
+
+// Close stops accepting new events and waits for running handlers to finish,
+// events the handlers publish meanwhile are still delivered.
+// Handlers waiting to be retried are moved to dead letters right away.
+// If handlers are still running when ctx is done, their contexts are
+// cancelled and ctx's error is returned
+func (eb *EventBus) Close(ctx context.Context) error {
+	eb.lock.Lock()
+	if !eb.closed {
+		eb.closed = true
+		close(eb.done)
+	}
+	eb.lock.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		eb.running.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		eb.cancel()
+		eb.logger.Info("event bus closed")
+		return nil
+	case <-ctx.Done():
+		eb.cancel()
+		return ctx.Err()
 	}
 }
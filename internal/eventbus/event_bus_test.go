@@ -2,18 +2,21 @@ package eventbus
 
 import (
 	"context"
+	"errors"
 	"io"
 	"log/slog"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestSubscribe(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
 	eb := NewEventBus(logger)
 
-	a := func(ctx context.Context, e Event) {}
+	a := func(ctx context.Context, e Event) error { return nil }
 	eb.Subscribe("event-1", a)
 	eb.Subscribe("event-1", a)
 
@@ -38,9 +41,10 @@ func TestPublish(t *testing.T) {
 	var wg sync.WaitGroup
 	wg.Add(2)
 
-	handler := func(ctx context.Context, e Event) {
+	handler := func(ctx context.Context, e Event) error {
 		defer wg.Done()
 		count.Add(1)
+		return nil
 	}
 
 	eb.Subscribe("event-1", handler)
@@ -54,3 +58,595 @@ func TestPublish(t *testing.T) {
 		t.Fatalf("after publishing, count is %d, want %d", gotCount, 2)
 	}
 }
+
+func TestClose(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	t.Run("waits for handlers", func(t *testing.T) {
+		eb := NewEventBus(logger)
+
+		started := make(chan struct{})
+		release := make(chan struct{})
+		var finished atomic.Bool
+
+		eb.Subscribe("event-1", func(ctx context.Context, e Event) error {
+			close(started)
+			<-release
+			finished.Store(true)
+			return nil
+		})
+
+		eb.Publish(context.Background(), "event-1", struct{}{})
+		<-started
+
+		closed := make(chan error)
+		go func() {
+			closed <- eb.Close(context.Background())
+		}()
+
+		select {
+		case <-closed:
+			t.Fatal("Close() returned while a handler was running")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		close(release)
+
+		if err := <-closed; err != nil {
+			t.Fatalf("Close() returned an error: %v", err)
+		}
+
+		if !finished.Load() {
+			t.Error("Close() returned before the handler finished")
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		eb := NewEventBus(logger)
+
+		release := make(chan struct{})
+		defer close(release)
+
+		eb.Subscribe("event-1", func(ctx context.Context, e Event) error {
+			<-release
+			return nil
+		})
+		eb.Publish(context.Background(), "event-1", struct{}{})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		if err := eb.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("got error %v, want %v", err, context.DeadlineExceeded)
+		}
+	})
+
+	t.Run("drops events after close", func(t *testing.T) {
+		eb := NewEventBus(logger)
+
+		var count atomic.Int32
+		eb.Subscribe("event-1", func(ctx context.Context, e Event) error {
+			count.Add(1)
+			return nil
+		})
+
+		if err := eb.Close(context.Background()); err != nil {
+			t.Fatalf("Close() returned an error: %v", err)
+		}
+
+		eb.Publish(context.Background(), "event-1", struct{}{})
+		time.Sleep(50 * time.Millisecond)
+
+		if got := count.Load(); got != 0 {
+			t.Errorf("handler was called %d times after close", got)
+		}
+	})
+
+	t.Run("delivers events of draining handlers", func(t *testing.T) {
+		eb := NewEventBus(logger)
+
+		release := make(chan struct{})
+		var delivered atomic.Bool
+
+		eb.Subscribe("event-1", func(ctx context.Context, e Event) error {
+			<-release
+			eb.Publish(ctx, "event-2", struct{}{})
+			return nil
+		})
+		eb.Subscribe("event-2", func(ctx context.Context, e Event) error {
+			delivered.Store(true)
+			return nil
+		})
+
+		eb.Publish(context.Background(), "event-1", struct{}{})
+
+		closed := make(chan error)
+		go func() {
+			closed <- eb.Close(context.Background())
+		}()
+
+		// let Close start draining before the handler publishes
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+
+		if err := <-closed; err != nil {
+			t.Fatalf("Close() returned an error: %v", err)
+		}
+
+		if !delivered.Load() {
+			t.Error("event published by a draining handler was dropped")
+		}
+	})
+
+	t.Run("concurrent publish", func(t *testing.T) {
+		eb := NewEventBus(logger)
+
+		var started, finished atomic.Int32
+		eb.Subscribe("event-1", func(ctx context.Context, e Event) error {
+			started.Add(1)
+			time.Sleep(time.Millisecond)
+			finished.Add(1)
+			return nil
+		})
+
+		var wg sync.WaitGroup
+		for range 50 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				eb.Publish(context.Background(), "event-1", struct{}{})
+			}()
+		}
+
+		if err := eb.Close(context.Background()); err != nil {
+			t.Fatalf("Close() returned an error: %v", err)
+		}
+
+		if started.Load() != finished.Load() {
+			t.Errorf("%d handlers started, but only %d finished", started.Load(), finished.Load())
+		}
+
+		wg.Wait()
+	})
+}
+
+type memoryDeadLetters struct {
+	lock    sync.Mutex
+	letters []DeadLetter
+	added   chan struct{}
+}
+
+func newMemoryDeadLetters() *memoryDeadLetters {
+	return &memoryDeadLetters{added: make(chan struct{}, 10)}
+}
+
+func (s *memoryDeadLetters) AddDeadLetter(ctx context.Context, dl DeadLetter) error {
+	s.lock.Lock()
+	s.letters = append(s.letters, dl)
+	s.lock.Unlock()
+
+	s.added <- struct{}{}
+	return nil
+}
+
+func (s *memoryDeadLetters) wait(t *testing.T) DeadLetter {
+	t.Helper()
+
+	select {
+	case <-s.added:
+	case <-time.After(time.Second):
+		t.Fatal("no dead letter was added")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.letters[len(s.letters)-1]
+}
+
+func TestRetry(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+	errFailed := errors.New("handler failed")
+
+	t.Run("succeeds after retries", func(t *testing.T) {
+		eb := NewEventBus(logger)
+		store := newMemoryDeadLetters()
+		eb.SetDeadLetterStore(store)
+
+		var attempts atomic.Int32
+		succeeded := make(chan struct{})
+		eb.Subscribe("event-1", func(ctx context.Context, e Event) error {
+			if attempts.Add(1) < 3 {
+				return errFailed
+			}
+
+			close(succeeded)
+			return nil
+		}, WithRetry(policy))
+
+		eb.Publish(context.Background(), "event-1", struct{}{})
+
+		select {
+		case <-succeeded:
+		case <-time.After(time.Second):
+			t.Fatalf("handler didn't succeed, ran %d times", attempts.Load())
+		}
+
+		if err := eb.Close(context.Background()); err != nil {
+			t.Fatalf("Close() returned an error: %v", err)
+		}
+
+		if len(store.letters) != 0 {
+			t.Errorf("got dead letters %+v, want none", store.letters)
+		}
+	})
+
+	t.Run("dead letter after last attempt", func(t *testing.T) {
+		eb := NewEventBus(logger)
+		store := newMemoryDeadLetters()
+		eb.SetDeadLetterStore(store)
+
+		var attempts atomic.Int32
+		eb.Subscribe("event-1", func(ctx context.Context, e Event) error {
+			attempts.Add(1)
+			return errFailed
+		}, WithName("failing"), WithRetry(policy))
+
+		eb.Publish(context.Background(), "event-1", map[string]int{"id": 1})
+		dl := store.wait(t)
+
+		if got := attempts.Load(); got != 3 {
+			t.Errorf("handler ran %d times, want 3", got)
+		}
+
+		if dl.EventType != "event-1" || dl.Subscriber != "failing" || dl.Attempts != 3 {
+			t.Errorf("got dead letter %+v, want event-1 of failing after 3 attempts", dl)
+		}
+
+		if dl.Error != errFailed.Error() || string(dl.Payload) != `{"id":1}` {
+			t.Errorf("got error %q and payload %s", dl.Error, dl.Payload)
+		}
+	})
+
+	t.Run("panic is retried", func(t *testing.T) {
+		eb := NewEventBus(logger)
+		store := newMemoryDeadLetters()
+		eb.SetDeadLetterStore(store)
+
+		eb.Subscribe("event-1", func(ctx context.Context, e Event) error {
+			panic("handler panicked")
+		}, WithRetry(policy))
+
+		eb.Publish(context.Background(), "event-1", struct{}{})
+
+		if dl := store.wait(t); dl.Attempts != 3 || dl.Error != "panic: handler panicked" {
+			t.Errorf("got dead letter %+v, want a panic after 3 attempts", dl)
+		}
+	})
+
+	t.Run("close cuts backoff short", func(t *testing.T) {
+		eb := NewEventBus(logger)
+		store := newMemoryDeadLetters()
+		eb.SetDeadLetterStore(store)
+
+		failed := make(chan struct{})
+		eb.Subscribe("event-1", func(ctx context.Context, e Event) error {
+			close(failed)
+			return errFailed
+		}, WithRetry(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Hour}))
+
+		eb.Publish(context.Background(), "event-1", struct{}{})
+		<-failed
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		if err := eb.Close(ctx); err != nil {
+			t.Fatalf("Close() returned an error: %v", err)
+		}
+
+		if dl := store.wait(t); dl.Attempts != 1 {
+			t.Errorf("got dead letter after %d attempts, want 1", dl.Attempts)
+		}
+	})
+}
+
+func TestPublishAndWait(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	errFailed := errors.New("handler failed")
+
+	t.Run("waits for handlers", func(t *testing.T) {
+		eb := NewEventBus(logger)
+
+		var finished atomic.Int32
+		for _, key := range []func(string) string{nil, func(e string) string { return e }} {
+			opts := []SubscribeOption{}
+			if key != nil {
+				opts = append(opts, WithKey(key))
+			}
+
+			eb.Subscribe("event-1", func(ctx context.Context, e Event) error {
+				time.Sleep(20 * time.Millisecond)
+				finished.Add(1)
+				return nil
+			}, opts...)
+		}
+
+		if err := eb.PublishAndWait(context.Background(), "event-1", "key"); err != nil {
+			t.Fatalf("PublishAndWait() returned an error: %v", err)
+		}
+
+		if got := finished.Load(); got != 2 {
+			t.Errorf("%d handlers finished, want 2", got)
+		}
+	})
+
+	t.Run("returns errors instead of dead letters", func(t *testing.T) {
+		eb := NewEventBus(logger)
+		store := newMemoryDeadLetters()
+		eb.SetDeadLetterStore(store)
+
+		eb.Subscribe("event-1", func(ctx context.Context, e Event) error {
+			return nil
+		})
+		eb.Subscribe("event-1", func(ctx context.Context, e Event) error {
+			return errFailed
+		}, WithRetry(RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}))
+
+		if err := eb.PublishAndWait(context.Background(), "event-1", struct{}{}); !errors.Is(err, errFailed) {
+			t.Errorf("got error %v, want %v", err, errFailed)
+		}
+
+		if len(store.letters) != 0 {
+			t.Errorf("got dead letters %+v, want none", store.letters)
+		}
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		eb := NewEventBus(logger)
+
+		if err := eb.Close(context.Background()); err != nil {
+			t.Fatalf("Close() returned an error: %v", err)
+		}
+
+		if err := eb.PublishAndWait(context.Background(), "event-1", struct{}{}); !errors.Is(err, ErrClosed) {
+			t.Errorf("got error %v, want %v", err, ErrClosed)
+		}
+	})
+}
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}
+
+	for attempt, want := range map[int]time.Duration{
+		1:   time.Second,
+		2:   2 * time.Second,
+		3:   4 * time.Second,
+		4:   5 * time.Second,
+		100: 5 * time.Second,
+	} {
+		if got := policy.backoff(attempt); got != want {
+			t.Errorf("backoff(%d) = %v, want %v", attempt, got, want)
+		}
+	}
+}
+
+func TestHandlerContext(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	t.Run("detached from publisher", func(t *testing.T) {
+		eb := NewEventBus(logger)
+
+		ctx, cancel := context.WithCancel(context.Background())
+
+		started := make(chan struct{})
+		result := make(chan error)
+		eb.Subscribe("event-1", func(ctx context.Context, e Event) error {
+			close(started)
+			time.Sleep(20 * time.Millisecond)
+			result <- ctx.Err()
+			return nil
+		})
+
+		eb.Publish(ctx, "event-1", struct{}{})
+		<-started
+		cancel()
+
+		if err := <-result; err != nil {
+			t.Errorf("handler context was cancelled with the publisher: %v", err)
+		}
+	})
+
+	t.Run("event id", func(t *testing.T) {
+		eb := NewEventBus(logger)
+
+		ids := make(chan string, 4)
+		for range 2 {
+			eb.Subscribe("event-1", func(ctx context.Context, e Event) error {
+				ids <- EventID(ctx)
+				return nil
+			})
+		}
+
+		eb.Publish(context.Background(), "event-1", struct{}{})
+		first, second := <-ids, <-ids
+		if first == "" || first != second {
+			t.Errorf("handlers got ids %q and %q, want the same generated id", first, second)
+		}
+
+		eb.Publish(WithEventID(context.Background(), "request-1"), "event-1", struct{}{})
+		if got := <-ids; got != "request-1" {
+			t.Errorf("handler got id %q, want the publisher's request-1", got)
+		}
+		<-ids
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		eb := NewEventBus(logger)
+		eb.SetHandlerTimeout(time.Hour)
+
+		result := make(chan error)
+		eb.Subscribe("event-1", func(ctx context.Context, e Event) error {
+			<-ctx.Done()
+			result <- ctx.Err()
+			return nil
+		}, WithTimeout(10*time.Millisecond))
+
+		eb.Publish(context.Background(), "event-1", struct{}{})
+
+		select {
+		case err := <-result:
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("got error %v, want %v", err, context.DeadlineExceeded)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("handler context didn't time out")
+		}
+	})
+
+	t.Run("cancelled when close gives up", func(t *testing.T) {
+		eb := NewEventBus(logger)
+
+		started := make(chan struct{})
+		result := make(chan error, 1)
+		eb.Subscribe("event-1", func(ctx context.Context, e Event) error {
+			close(started)
+			<-ctx.Done()
+			result <- ctx.Err()
+			return nil
+		})
+
+		eb.Publish(context.Background(), "event-1", struct{}{})
+		<-started
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		if err := eb.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("got error %v, want %v", err, context.DeadlineExceeded)
+		}
+
+		select {
+		case err := <-result:
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("got error %v, want %v", err, context.Canceled)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("handler context wasn't cancelled")
+		}
+	})
+}
+
+func TestKeyedDispatch(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	type keyed struct {
+		Key string
+		N   int
+	}
+
+	byKey := WithKey(func(e keyed) string { return e.Key })
+
+	t.Run("same key in order", func(t *testing.T) {
+		eb := NewEventBus(logger)
+
+		var lock sync.Mutex
+		var got []int
+		var running, maxRunning atomic.Int32
+
+		eb.Subscribe("event-1", func(ctx context.Context, e Event) error {
+			n := running.Add(1)
+			defer running.Add(-1)
+
+			if n > maxRunning.Load() {
+				maxRunning.Store(n)
+			}
+
+			time.Sleep(time.Millisecond)
+
+			lock.Lock()
+			got = append(got, e.(keyed).N)
+			lock.Unlock()
+
+			return nil
+		}, byKey)
+
+		want := make([]int, 20)
+		for i := range want {
+			want[i] = i
+			eb.Publish(context.Background(), "event-1", keyed{Key: "a", N: i})
+		}
+
+		if err := eb.Close(context.Background()); err != nil {
+			t.Fatalf("Close() returned an error: %v", err)
+		}
+
+		if !slices.Equal(got, want) {
+			t.Errorf("handled events in order %v, want %v", got, want)
+		}
+
+		if maxRunning.Load() != 1 {
+			t.Errorf("%d handlers ran at once, want 1", maxRunning.Load())
+		}
+	})
+
+	t.Run("different keys in parallel", func(t *testing.T) {
+		eb := NewEventBus(logger)
+
+		started := map[string]chan struct{}{
+			"a": make(chan struct{}),
+			"b": make(chan struct{}),
+		}
+		other := map[string]string{"a": "b", "b": "a"}
+
+		result := make(chan error, 2)
+		eb.Subscribe("event-1", func(ctx context.Context, e Event) error {
+			key := e.(keyed).Key
+			close(started[key])
+
+			select {
+			case <-started[other[key]]:
+				result <- nil
+			case <-time.After(time.Second):
+				result <- errors.New("handler of " + other[key] + " didn't start")
+			}
+
+			return nil
+		}, byKey)
+
+		eb.Publish(context.Background(), "event-1", keyed{Key: "a"})
+		eb.Publish(context.Background(), "event-1", keyed{Key: "b"})
+
+		for range 2 {
+			if err := <-result; err != nil {
+				t.Error(err)
+			}
+		}
+	})
+
+	t.Run("queue is released", func(t *testing.T) {
+		eb := NewEventBus(logger)
+
+		done := make(chan struct{})
+		eb.Subscribe("event-1", func(ctx context.Context, e Event) error {
+			done <- struct{}{}
+			return nil
+		}, byKey)
+		s := eb.handlers["event-1"][0]
+
+		eb.Publish(context.Background(), "event-1", keyed{Key: "a"})
+		<-done
+
+		if err := eb.Close(context.Background()); err != nil {
+			t.Fatalf("Close() returned an error: %v", err)
+		}
+
+		s.queueLock.Lock()
+		defer s.queueLock.Unlock()
+
+		if len(s.queues) != 0 {
+			t.Errorf("got queues %v after the events were handled, want none", s.queues)
+		}
+	})
+}
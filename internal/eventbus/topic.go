@@ -0,0 +1,60 @@
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Topic is an event type bound to its payload type, publishing and
+// subscribing through it is checked at compile time
+type Topic[T any] struct {
+	eventType EventType
+}
+
+func NewTopic[T any](eventType EventType) Topic[T] {
+	return Topic[T]{eventType: eventType}
+}
+
+func (t Topic[T]) EventType() EventType {
+	return t.eventType
+}
+
+func (t Topic[T]) String() string {
+	return string(t.eventType)
+}
+
+func (t Topic[T]) Publish(ctx context.Context, bus *EventBus, event T) {
+	bus.Publish(ctx, t.eventType, event)
+}
+
+func (t Topic[T]) PublishAndWait(ctx context.Context, bus *EventBus, event T) error {
+	return bus.PublishAndWait(ctx, t.eventType, event)
+}
+
+// Subscribe registers a handler for the topic. Events of the same type
+// published with a different payload through EventBus.Publish are logged
+// and dropped instead of reaching the handler.
+// Dead letters of the subscription are decoded back into T on replay
+func (t Topic[T]) Subscribe(bus *EventBus, handler func(context.Context, T) error, opts ...SubscribeOption) {
+	decode := withDecoder(func(data json.RawMessage) (Event, error) {
+		var payload T
+		err := json.Unmarshal(data, &payload)
+		return payload, err
+	})
+
+	bus.Subscribe(t.eventType, func(ctx context.Context, e Event) error {
+		payload, ok := e.(T)
+		if !ok {
+			bus.logger.ErrorContext(
+				ctx,
+				"unexpected event payload",
+				"event", t.eventType,
+				"payload", fmt.Sprintf("%T", e),
+			)
+			return nil
+		}
+
+		return handler(ctx, payload)
+	}, append([]SubscribeOption{decode}, opts...)...)
+}
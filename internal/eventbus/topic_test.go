@@ -0,0 +1,123 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+type testPayload struct {
+	ID int
+}
+
+func TestTopic(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	topic := NewTopic[testPayload]("test-event")
+
+	t.Run("publish and subscribe", func(t *testing.T) {
+		eb := NewEventBus(logger)
+
+		received := make(chan testPayload, 1)
+		topic.Subscribe(eb, func(ctx context.Context, p testPayload) error {
+			received <- p
+			return nil
+		})
+
+		topic.Publish(context.Background(), eb, testPayload{ID: 1})
+
+		select {
+		case got := <-received:
+			if got.ID != 1 {
+				t.Errorf("got payload %+v, want ID 1", got)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("handler wasn't called")
+		}
+	})
+
+	t.Run("unexpected payload", func(t *testing.T) {
+		eb := NewEventBus(logger)
+
+		received := make(chan testPayload, 1)
+		topic.Subscribe(eb, func(ctx context.Context, p testPayload) error {
+			received <- p
+			return nil
+		})
+
+		eb.Publish(context.Background(), topic.EventType(), "not a test payload")
+
+		select {
+		case got := <-received:
+			t.Errorf("handler was called with %+v", got)
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+
+	t.Run("panic recovery", func(t *testing.T) {
+		eb := NewEventBus(logger)
+
+		received := make(chan testPayload, 2)
+		topic.Subscribe(eb, func(ctx context.Context, p testPayload) error {
+			if p.ID == 0 {
+				panic("handler failed")
+			}
+
+			received <- p
+			return nil
+		})
+
+		topic.Publish(context.Background(), eb, testPayload{ID: 0})
+		topic.Publish(context.Background(), eb, testPayload{ID: 1})
+
+		select {
+		case got := <-received:
+			if got.ID != 1 {
+				t.Errorf("got payload %+v, want ID 1", got)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("handler wasn't called after a panic")
+		}
+	})
+}
+
+func TestReplay(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	topic := NewTopic[testPayload]("test-event")
+
+	eb := NewEventBus(logger)
+
+	received := make(chan testPayload, 1)
+	topic.Subscribe(eb, func(ctx context.Context, p testPayload) error {
+		received <- p
+		return nil
+	}, WithName("receiver"))
+
+	t.Run("decodes the payload", func(t *testing.T) {
+		err := eb.Replay(context.Background(), DeadLetter{
+			EventType:  topic.EventType(),
+			Subscriber: "receiver",
+			Payload:    []byte(`{"ID":7}`),
+		})
+		if err != nil {
+			t.Fatalf("Replay() failed: %v", err)
+		}
+
+		if got := <-received; got.ID != 7 {
+			t.Errorf("got payload %+v, want ID 7", got)
+		}
+	})
+
+	t.Run("unknown subscriber", func(t *testing.T) {
+		err := eb.Replay(context.Background(), DeadLetter{
+			EventType:  topic.EventType(),
+			Subscriber: "someone else",
+			Payload:    []byte(`{"ID":7}`),
+		})
+		if !errors.Is(err, ErrSubscriberNotFound) {
+			t.Errorf("got error %v, want %v", err, ErrSubscriberNotFound)
+		}
+	})
+}
@@ -0,0 +1,44 @@
+// Package events defines every event the app publishes
+package events
+
+import (
+	"github.com/andrewyazura/duty-reminder/internal/domain"
+	"github.com/andrewyazura/duty-reminder/internal/eventbus"
+	"github.com/andrewyazura/duty-reminder/internal/telegram"
+)
+
+// HouseholdChanged only carries the id, handlers reload the household
+type HouseholdChanged struct {
+	HouseholdID int64
+}
+
+var (
+	// TelegramUpdate is published for every update from the webhook or polling
+	TelegramUpdate = eventbus.NewTopic[telegram.Update]("TelegramUpdate")
+
+	HouseholdCreated        = eventbus.NewTopic[HouseholdChanged]("HouseholdCreated")
+	HouseholdCrontabUpdated = eventbus.NewTopic[HouseholdChanged]("HouseholdCrontabUpdated")
+	HouseholdDeleted        = eventbus.NewTopic[HouseholdChanged]("HouseholdDeleted")
+
+	// NotifyHousehold is published when a household's schedule fires
+	NotifyHousehold = eventbus.NewTopic[domain.Occurrence]("NotifyHousehold")
+	// ReminderScheduled asks the scheduler to publish RemindAssignment later
+	ReminderScheduled = eventbus.NewTopic[domain.Reminder]("ReminderScheduled")
+	RemindAssignment  = eventbus.NewTopic[domain.Reminder]("RemindAssignment")
+)
+
+// HouseholdTopic finds a household topic by its event type, it is used for
+// events read back from the outbox
+func HouseholdTopic(eventType string) (eventbus.Topic[HouseholdChanged], bool) {
+	for _, t := range []eventbus.Topic[HouseholdChanged]{
+		HouseholdCreated,
+		HouseholdCrontabUpdated,
+		HouseholdDeleted,
+	} {
+		if t.String() == eventType {
+			return t, true
+		}
+	}
+
+	return eventbus.Topic[HouseholdChanged]{}, false
+}
@@ -0,0 +1,283 @@
+// Package migrations
+package migrations
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// lockID is the key of the advisory lock that serializes migrations
+// started by several instances at once
+const lockID = 4_153_221
+
+type DB interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Status struct {
+	Migration *Migration
+	AppliedAt *time.Time
+}
+
+type Migrator struct {
+	db         DB
+	logger     *slog.Logger
+	migrations []*Migration
+}
+
+func New(db DB, logger *slog.Logger) (*Migrator, error) {
+	migrations, err := load(files)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		db:         db,
+		logger:     logger,
+		migrations: migrations,
+	}, nil
+}
+
+// load reads migrations named like 0001_name.up.sql and 0001_name.down.sql
+func load(fsys fs.FS) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fsys, "sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, e := range entries {
+		filename := e.Name()
+
+		base, direction, ok := strings.Cut(strings.TrimSuffix(filename, ".sql"), ".")
+		rawVersion, name, _ := strings.Cut(base, "_")
+		version, err := strconv.Atoi(rawVersion)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("invalid migration filename %s", filename)
+		}
+
+		data, err := fs.ReadFile(fsys, path.Join("sql", filename))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+
+		switch direction {
+		case "up":
+			m.Up = string(data)
+		case "down":
+			m.Down = string(data)
+		default:
+			return nil, fmt.Errorf("invalid migration direction in %s", filename)
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d has no up script", m.Version)
+		}
+
+		migrations = append(migrations, m)
+	}
+
+	slices.SortFunc(migrations, func(a, b *Migration) int {
+		return a.Version - b.Version
+	})
+
+	return migrations, nil
+}
+
+// Up applies all pending migrations, each in its own transaction
+func (m *Migrator) Up(ctx context.Context) error {
+	if err := m.createTable(ctx); err != nil {
+		return err
+	}
+
+	for _, migration := range m.migrations {
+		err := m.inTransaction(ctx, func(tx pgx.Tx) error {
+			applied, err := m.applied(ctx, tx)
+			if err != nil {
+				return err
+			}
+
+			if _, ok := applied[migration.Version]; ok {
+				return nil
+			}
+
+			if _, err := tx.Exec(ctx, migration.Up); err != nil {
+				return err
+			}
+
+			_, err = tx.Exec(
+				ctx,
+				`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`,
+				migration.Version,
+				migration.Name,
+			)
+			if err != nil {
+				return err
+			}
+
+			m.logger.Info("applied migration", "version", migration.Version, "name", migration.Name)
+			return nil
+		})
+
+		if err != nil {
+			return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// Down rolls back the latest applied migration
+func (m *Migrator) Down(ctx context.Context) error {
+	if err := m.createTable(ctx); err != nil {
+		return err
+	}
+
+	return m.inTransaction(ctx, func(tx pgx.Tx) error {
+		applied, err := m.applied(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range slices.Backward(m.migrations) {
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+
+			if migration.Down == "" {
+				return fmt.Errorf("migration %d_%s can't be rolled back", migration.Version, migration.Name)
+			}
+
+			if _, err := tx.Exec(ctx, migration.Down); err != nil {
+				return err
+			}
+
+			_, err = tx.Exec(ctx, `DELETE FROM schema_migrations WHERE version = $1`, migration.Version)
+			if err != nil {
+				return err
+			}
+
+			m.logger.Info("rolled back migration", "version", migration.Version, "name", migration.Name)
+			return nil
+		}
+
+		m.logger.Info("no migrations to roll back")
+		return nil
+	})
+}
+
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	if err := m.createTable(ctx); err != nil {
+		return nil, err
+	}
+
+	var statuses []Status
+	err := m.inTransaction(ctx, func(tx pgx.Tx) error {
+		applied, err := m.applied(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			s := Status{Migration: migration}
+			if appliedAt, ok := applied[migration.Version]; ok {
+				s.AppliedAt = &appliedAt
+			}
+
+			statuses = append(statuses, s)
+		}
+
+		return nil
+	})
+
+	return statuses, err
+}
+
+func (m *Migrator) createTable(ctx context.Context) error {
+	_, err := m.db.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)
+	`)
+
+	return err
+}
+
+func (m *Migrator) applied(ctx context.Context, tx pgx.Tx) (map[int]time.Time, error) {
+	rows, err := tx.Query(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+
+		applied[version] = appliedAt
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return applied, nil
+}
+
+func (m *Migrator) inTransaction(ctx context.Context, fn func(tx pgx.Tx) error) error {
+	tx, err := m.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, lockID); err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
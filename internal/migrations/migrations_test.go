@@ -0,0 +1,70 @@
+package migrations
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoad(t *testing.T) {
+	t.Run("embedded", func(t *testing.T) {
+		migrations, err := load(files)
+		if err != nil {
+			t.Fatalf("load() returned an error: %v", err)
+		}
+
+		if len(migrations) == 0 {
+			t.Fatal("no migrations loaded")
+		}
+
+		for i, m := range migrations {
+			if m.Version != i+1 {
+				t.Errorf("migration %d has version %d, want %d", i, m.Version, i+1)
+			}
+
+			if m.Up == "" || m.Down == "" {
+				t.Errorf("migration %d_%s is missing a script", m.Version, m.Name)
+			}
+		}
+	})
+
+	t.Run("sorted", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"sql/0010_later.up.sql":  {Data: []byte("SELECT 10")},
+			"sql/0002_second.up.sql": {Data: []byte("SELECT 2")},
+			"sql/0001_first.up.sql":  {Data: []byte("SELECT 1")},
+		}
+
+		migrations, err := load(fsys)
+		if err != nil {
+			t.Fatalf("load() returned an error: %v", err)
+		}
+
+		var got []int
+		for _, m := range migrations {
+			got = append(got, m.Version)
+		}
+
+		if len(got) != 3 || got[0] != 1 || got[1] != 2 || got[2] != 10 {
+			t.Errorf("got versions %v, want [1 2 10]", got)
+		}
+
+		if migrations[0].Name != "first" {
+			t.Errorf("got name %s, want %s", migrations[0].Name, "first")
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, filename := range []string{
+			"sql/first.up.sql",
+			"sql/0001_first.sideways.sql",
+			"sql/0001_first.sql",
+			"sql/0001_first.down.sql",
+		} {
+			fsys := fstest.MapFS{filename: {Data: []byte("SELECT 1")}}
+
+			if _, err := load(fsys); err == nil {
+				t.Errorf("load() with %s did not return an error", filename)
+			}
+		}
+	})
+}
@@ -1,11 +1,12 @@
-CREATE TABLE households (
+-- IF NOT EXISTS adopts databases created from the old hand-applied schema.sql
+CREATE TABLE IF NOT EXISTS households (
   checklist TEXT[] NOT NULL DEFAULT '{}',
   crontab TEXT NOT NULL,
   current_member_index INTEGER NOT NULL DEFAULT 0,
   telegram_id BIGINT PRIMARY KEY
 );
 
-CREATE TABLE members (
+CREATE TABLE IF NOT EXISTS members (
   household_telegram_id BIGINT NOT NULL REFERENCES households(telegram_id),
   name TEXT NOT NULL,
   "order" INTEGER NOT NULL,
@@ -0,0 +1 @@
+ALTER TABLE members ADD COLUMN IF NOT EXISTS username TEXT NOT NULL DEFAULT '';
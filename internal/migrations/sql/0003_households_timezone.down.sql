@@ -0,0 +1 @@
+ALTER TABLE households DROP COLUMN timezone;
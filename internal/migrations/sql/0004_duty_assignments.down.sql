@@ -0,0 +1,2 @@
+DROP TABLE duty_assignment_items;
+DROP TABLE duty_assignments;
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS duty_assignments (
+  id BIGSERIAL PRIMARY KEY,
+  household_telegram_id BIGINT NOT NULL REFERENCES households(telegram_id),
+  member_telegram_id BIGINT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS duty_assignment_items (
+  assignment_id BIGINT NOT NULL REFERENCES duty_assignments(id) ON DELETE CASCADE,
+  position INTEGER NOT NULL,
+  name TEXT NOT NULL,
+  completed_by BIGINT,
+  completed_at TIMESTAMPTZ,
+  PRIMARY KEY (assignment_id, position)
+);
@@ -0,0 +1,3 @@
+ALTER TABLE households
+  DROP COLUMN reminder_delay_hours,
+  DROP COLUMN escalation_delay_hours;
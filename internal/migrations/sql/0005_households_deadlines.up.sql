@@ -0,0 +1,3 @@
+ALTER TABLE households
+  ADD COLUMN IF NOT EXISTS reminder_delay_hours INTEGER NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS escalation_delay_hours INTEGER NOT NULL DEFAULT 0;
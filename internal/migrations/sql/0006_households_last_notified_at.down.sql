@@ -0,0 +1,2 @@
+ALTER TABLE households
+  DROP COLUMN last_notified_at;
@@ -0,0 +1,2 @@
+ALTER TABLE households
+  ADD COLUMN IF NOT EXISTS last_notified_at TIMESTAMPTZ;
@@ -0,0 +1 @@
+DROP TABLE household_notifications;
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS household_notifications (
+  household_telegram_id BIGINT NOT NULL REFERENCES households(telegram_id),
+  scheduled_at TIMESTAMPTZ NOT NULL,
+  claimed_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (household_telegram_id, scheduled_at)
+);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS dead_letters (
+  id BIGSERIAL PRIMARY KEY,
+  event_type TEXT NOT NULL,
+  subscriber TEXT NOT NULL,
+  payload JSONB NOT NULL,
+  error TEXT NOT NULL,
+  attempts INT NOT NULL,
+  failed_at TIMESTAMPTZ NOT NULL,
+  replayed_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS dead_letters_pending_idx ON dead_letters (id) WHERE replayed_at IS NULL;
@@ -0,0 +1,2 @@
+-- the backfilled timestamps are kept, they are dropped with the column by 0006
+SELECT 1;
@@ -0,0 +1,9 @@
+-- households notified before last_notified_at existed have a member on duty,
+-- their latest assignment tells when they were notified
+UPDATE households h
+SET last_notified_at = (
+  SELECT max(a.created_at)
+  FROM duty_assignments a
+  WHERE a.household_telegram_id = h.telegram_id
+)
+WHERE h.last_notified_at IS NULL;
@@ -0,0 +1 @@
+DROP TABLE assignment_reminders;
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS assignment_reminders (
+  assignment_id BIGINT NOT NULL REFERENCES duty_assignments (id) ON DELETE CASCADE,
+  escalate BOOLEAN NOT NULL,
+  claimed_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (assignment_id, escalate)
+);
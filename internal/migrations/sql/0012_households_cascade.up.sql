@@ -0,0 +1,9 @@
+ALTER TABLE duty_assignments
+  DROP CONSTRAINT IF EXISTS duty_assignments_household_telegram_id_fkey,
+  ADD CONSTRAINT duty_assignments_household_telegram_id_fkey
+    FOREIGN KEY (household_telegram_id) REFERENCES households(telegram_id) ON DELETE CASCADE;
+
+ALTER TABLE household_notifications
+  DROP CONSTRAINT IF EXISTS household_notifications_household_telegram_id_fkey,
+  ADD CONSTRAINT household_notifications_household_telegram_id_fkey
+    FOREIGN KEY (household_telegram_id) REFERENCES households(telegram_id) ON DELETE CASCADE;
@@ -0,0 +1,2 @@
+ALTER TABLE households
+  DROP COLUMN on_duty_telegram_id;
@@ -0,0 +1,13 @@
+ALTER TABLE households
+  ADD COLUMN IF NOT EXISTS on_duty_telegram_id BIGINT;
+
+-- the member on duty is the one their latest assignment was given to
+UPDATE households h
+SET on_duty_telegram_id = (
+  SELECT a.member_telegram_id
+  FROM duty_assignments a
+  WHERE a.household_telegram_id = h.telegram_id
+  ORDER BY a.id DESC
+  LIMIT 1
+)
+WHERE h.on_duty_telegram_id IS NULL;
@@ -0,0 +1,3 @@
+ALTER TABLE outbox
+  ADD COLUMN IF NOT EXISTS attempts INTEGER NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS claimed_until TIMESTAMPTZ;
@@ -0,0 +1,106 @@
+package scheduler
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/andrewyazura/duty-reminder/internal/domain"
+	"github.com/go-co-op/gocron/v2"
+)
+
+// householdTag tags gocron jobs so they can be found by household
+func householdTag(telegramID int64) string {
+	return fmt.Sprintf("household:%d", telegramID)
+}
+
+// reminderTag tags gocron jobs so a reminder isn't scheduled twice
+func reminderTag(r domain.Reminder) string {
+	return fmt.Sprintf("reminder:%d:%t", r.AssignmentID, r.Escalate)
+}
+
+// householdJob is a scheduled household job and the cron spec it runs on
+type householdJob struct {
+	gocron.Job
+	spec string
+}
+
+// householdLock is a household's mutex and the number of operations that
+// hold or wait for it
+type householdLock struct {
+	sync.Mutex
+	refs int
+}
+
+// jobRegistry is a concurrency-safe map of household jobs. Operations on the
+// same household are serialized with lockHousehold, different households
+// don't block each other
+type jobRegistry struct {
+	lock  sync.Mutex
+	jobs  map[int64]householdJob
+	locks map[int64]*householdLock
+}
+
+func newJobRegistry() *jobRegistry {
+	return &jobRegistry{
+		jobs:  make(map[int64]householdJob),
+		locks: make(map[int64]*householdLock),
+	}
+}
+
+// lockHousehold blocks until no other operation on the household is running,
+// the returned func releases the lock. The lock is dropped once nobody holds
+// or waits for it, so removed households don't leave their locks behind
+func (r *jobRegistry) lockHousehold(telegramID int64) func() {
+	r.lock.Lock()
+	l, ok := r.locks[telegramID]
+	if !ok {
+		l = &householdLock{}
+		r.locks[telegramID] = l
+	}
+	l.refs++
+	r.lock.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+
+		r.lock.Lock()
+		defer r.lock.Unlock()
+
+		l.refs--
+		if l.refs == 0 {
+			delete(r.locks, telegramID)
+		}
+	}
+}
+
+func (r *jobRegistry) get(telegramID int64) (householdJob, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	job, ok := r.jobs[telegramID]
+	return job, ok
+}
+
+func (r *jobRegistry) set(telegramID int64, job householdJob) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.jobs[telegramID] = job
+}
+
+func (r *jobRegistry) delete(telegramID int64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	delete(r.jobs, telegramID)
+}
+
+func (r *jobRegistry) ids() []int64 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return slices.Collect(maps.Keys(r.jobs))
+}
@@ -3,47 +3,105 @@ package scheduler
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
+	"slices"
+	"time"
 
+	"github.com/andrewyazura/duty-reminder/internal/config"
 	"github.com/andrewyazura/duty-reminder/internal/domain"
 	"github.com/andrewyazura/duty-reminder/internal/eventbus"
+	"github.com/andrewyazura/duty-reminder/internal/events"
 	"github.com/andrewyazura/duty-reminder/internal/services"
 	"github.com/andrewyazura/duty-reminder/internal/storage"
 	"github.com/go-co-op/gocron/v2"
+	"github.com/jonboulle/clockwork"
+	"github.com/robfig/cron/v3"
 )
 
+// schedulerRetryPolicy is used by event handlers, syncing a household is
+// idempotent and reminders that fail to schedule are better late than lost
+var schedulerRetryPolicy = eventbus.RetryPolicy{
+	MaxAttempts:    5,
+	InitialBackoff: time.Second,
+	MaxBackoff:     time.Minute,
+}
+
 type NotificationScheduler struct {
+	clock         clockwork.Clock
+	config        *config.SchedulerConfig
 	eventBus      *eventbus.EventBus
 	logger        *slog.Logger
 	scheduler     gocron.Scheduler
-	householdJobs map[int64]gocron.Job
+	householdJobs *jobRegistry
+	uow           services.UnitOfWork
 }
 
 func New(
 	bus *eventbus.EventBus,
+	config *config.SchedulerConfig,
 	logger *slog.Logger,
 	uow services.UnitOfWork,
+	clock clockwork.Clock,
 ) (*NotificationScheduler, error) {
-	s, err := gocron.NewScheduler()
+	s, err := gocron.NewScheduler(gocron.WithClock(clock))
 	if err != nil {
 		return nil, err
 	}
 
 	n := &NotificationScheduler{
+		clock:         clock,
+		config:        config,
 		eventBus:      bus,
 		logger:        logger,
 		scheduler:     s,
-		householdJobs: make(map[int64]gocron.Job),
+		householdJobs: newJobRegistry(),
+		uow:           uow,
+	}
+
+	// subscribed before catching up, so reminders of catch up notifications
+	// and changes made meanwhile aren't missed
+	for _, topic := range []eventbus.Topic[events.HouseholdChanged]{
+		events.HouseholdCreated,
+		events.HouseholdCrontabUpdated,
+		events.HouseholdDeleted,
+	} {
+		topic.Subscribe(
+			bus,
+			n.syncHouseholdJob,
+			eventbus.WithName("NotificationScheduler.syncHouseholdJob"),
+			eventbus.WithRetry(schedulerRetryPolicy),
+		)
 	}
 
-	err = n.registerJobs(uow)
+	events.ReminderScheduled.Subscribe(
+		bus,
+		n.createReminderJob,
+		eventbus.WithName("NotificationScheduler.createReminderJob"),
+		eventbus.WithRetry(schedulerRetryPolicy),
+	)
+
+	err = n.registerJobs(context.Background())
 	if err != nil {
 		return nil, err
 	}
 
-	bus.Subscribe("HouseholdCreated", n.createHouseholdJob)
-	bus.Subscribe("HouseholdCrontabUpdated", n.updateHouseholdJob)
-	bus.Subscribe("HouseholdDeleted", n.deleteHouseholdJob)
+	err = n.restoreReminders(context.Background(), clock.Now().Add(-config.MaxLateness))
+	if err != nil {
+		return nil, err
+	}
+
+	if config.ReconcileInterval > 0 {
+		_, err = s.NewJob(
+			gocron.DurationJob(config.ReconcileInterval),
+			gocron.NewTask(n.reconcile),
+			gocron.WithSingletonMode(gocron.LimitModeReschedule),
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	return n, nil
 }
@@ -64,113 +122,354 @@ func (n *NotificationScheduler) Shutdown() {
 	n.logger.Info("scheduler shutdown")
 }
 
-func (n *NotificationScheduler) registerJobs(uow services.UnitOfWork) error {
-	var households []*domain.Household
+func (n *NotificationScheduler) registerJobs(ctx context.Context) error {
+	households, err := n.getSchedules(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, h := range households {
+		unlock := n.householdJobs.lockHousehold(h.TelegramID)
+		err := n.scheduleHousehold(ctx, h)
+		unlock()
 
-	err := uow.Execute(context.Background(), func(repo storage.HouseholdRepository) error {
-		var err error
-		households, err = repo.GetSchedules(context.Background())
 		if err != nil {
 			return err
 		}
 
-		return nil
-	})
+		if missed, ok := n.missedRun(ctx, h); ok {
+			n.logger.InfoContext(
+				ctx,
+				"catching up on a missed notification",
+				"household", h.TelegramID,
+				"missed_at", missed,
+			)
+			events.NotifyHousehold.Publish(ctx, n.eventBus, domain.Occurrence{
+				HouseholdID: h.TelegramID,
+				ScheduledAt: missed,
+			})
+		}
+	}
+
+	return nil
+}
 
+// reconcile compares jobs with the households table and syncs households
+// that were created, changed or deleted without this instance noticing,
+// e.g. by another replica or directly in the database
+func (n *NotificationScheduler) reconcile(ctx context.Context) {
+	households, err := n.getSchedules(ctx)
 	if err != nil {
-		return err
+		n.logger.ErrorContext(ctx, "failed to reconcile household jobs", "error", err)
+		return
+	}
+
+	stale := make(map[int64]bool)
+	for _, id := range n.householdJobs.ids() {
+		stale[id] = true
 	}
 
 	for _, h := range households {
-		job, err := n.createJob(h)
+		delete(stale, h.TelegramID)
 
-		if err != nil {
-			return err
+		job, ok := n.householdJobs.get(h.TelegramID)
+		if !ok || job.spec != h.CronSpec() {
+			stale[h.TelegramID] = true
 		}
+	}
 
-		n.householdJobs[h.TelegramID] = job
+	// the list may be outdated by now, so every household is reloaded
+	for id := range stale {
+		if err := n.syncHousehold(ctx, id); err != nil {
+			n.logger.ErrorContext(ctx, "failed to sync a household job", "telegram_id", id, "error", err)
+		}
 	}
 
-	return nil
+	// due reminders were published on start or by their jobs already
+	if err := n.restoreReminders(ctx, n.clock.Now()); err != nil {
+		n.logger.ErrorContext(ctx, "failed to reconcile reminder jobs", "error", err)
+	}
+}
+
+func (n *NotificationScheduler) syncHouseholdJob(ctx context.Context, e events.HouseholdChanged) error {
+	return n.syncHousehold(ctx, e.HouseholdID)
 }
 
-func (n *NotificationScheduler) createHouseholdJob(ctx context.Context, event eventbus.Event) {
-	h := event.(*domain.Household)
+// syncHousehold reloads the household and schedules, replaces or removes
+// its job to match
+func (n *NotificationScheduler) syncHousehold(ctx context.Context, telegramID int64) error {
+	unlock := n.householdJobs.lockHousehold(telegramID)
+	defer unlock()
+
+	h, err := n.findHousehold(ctx, telegramID)
+	if errors.Is(err, storage.ErrHouseholdNotFound) {
+		n.removeJob(ctx, telegramID)
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
 
+	return n.scheduleHousehold(ctx, h)
+}
+
+// scheduleHousehold replaces household's job unless it already runs on the
+// same schedule. The caller must hold the household lock
+func (n *NotificationScheduler) scheduleHousehold(ctx context.Context, h *domain.Household) error {
+	old, ok := n.householdJobs.get(h.TelegramID)
+	if ok && old.spec == h.CronSpec() {
+		return nil
+	}
+
+	// the previous job is kept if the new one can't be created
 	job, err := n.createJob(h)
 	if err != nil {
-		n.logger.Error(
-			"failed to register a new household job",
-			"telegram_id", h.TelegramID,
-			"error", err,
-		)
+		return err
+	}
+
+	if ok {
+		err := n.scheduler.RemoveJob(old.ID())
+		if err != nil {
+			n.logger.ErrorContext(
+				ctx,
+				"failed to remove old household job",
+				"telegram_id", h.TelegramID,
+				"error", err,
+			)
+		}
 	}
 
-	n.logger.Info("created a job", "household", h.TelegramID)
+	n.householdJobs.set(h.TelegramID, householdJob{Job: job, spec: h.CronSpec()})
+	n.logger.InfoContext(ctx, "scheduled a job", "household", h.TelegramID, "spec", h.CronSpec())
 
-	n.householdJobs[h.TelegramID] = job
+	return nil
 }
 
-func (n *NotificationScheduler) updateHouseholdJob(ctx context.Context, event eventbus.Event) {
-	h := event.(*domain.Household)
+// removeJob removes household's job. The caller must hold the household lock
+func (n *NotificationScheduler) removeJob(ctx context.Context, telegramID int64) {
+	if _, ok := n.householdJobs.get(telegramID); !ok {
+		return
+	}
+
+	n.scheduler.RemoveByTags(householdTag(telegramID))
+	n.householdJobs.delete(telegramID)
+
+	n.logger.InfoContext(ctx, "deleted a job", "household", telegramID)
+}
+
+func (n *NotificationScheduler) createJob(h *domain.Household) (gocron.Job, error) {
+	return n.scheduler.NewJob(
+		gocron.CronJob(h.CronSpec(), false),
+		gocron.NewTask(n.notifyHousehold, h.TelegramID),
+		gocron.WithTags(householdTag(h.TelegramID)),
+	)
+}
+
+// notifyHousehold runs when household's job fires. The household is reloaded,
+// so a job that hasn't been synced with a changed schedule yet is skipped
+func (n *NotificationScheduler) notifyHousehold(ctx context.Context, telegramID int64) {
+	// the run's logs and the event it publishes share the id
+	ctx = eventbus.WithEventID(ctx, eventbus.NewEventID())
+
+	// crontabs have minute precision, rounding gives every replica the same
+	// occurrence despite small clock skew
+	scheduledAt := n.clock.Now().Round(time.Minute)
+
+	h, err := n.findHousehold(ctx, telegramID)
+	if errors.Is(err, storage.ErrHouseholdNotFound) {
+		n.logger.InfoContext(ctx, "household is gone, removing its job", "household", telegramID)
+
+		unlock := n.householdJobs.lockHousehold(telegramID)
+		n.removeJob(ctx, telegramID)
+		unlock()
 
-	job, ok := n.householdJobs[h.TelegramID]
-	if !ok {
 		return
 	}
 
-	err := n.scheduler.RemoveJob(job.ID())
 	if err != nil {
-		n.logger.Error(
-			"failed to remove old household job",
-			"telegram_id", h.TelegramID,
-			"error", err,
+		n.logger.ErrorContext(ctx, "failed to load a household", "telegram_id", telegramID, "error", err)
+		return
+	}
+
+	if job, ok := n.householdJobs.get(telegramID); !ok || job.spec != h.CronSpec() {
+		if err := n.syncHousehold(ctx, telegramID); err != nil {
+			n.logger.ErrorContext(ctx, "failed to sync a household job", "telegram_id", telegramID, "error", err)
+		}
+	}
+
+	if !n.firesAt(ctx, h, scheduledAt) {
+		n.logger.InfoContext(
+			ctx,
+			"skipping a run that isn't on household's schedule anymore",
+			"household", telegramID,
+			"scheduled_at", scheduledAt,
 		)
+		return
+	}
+
+	events.NotifyHousehold.Publish(ctx, n.eventBus, domain.Occurrence{
+		HouseholdID: telegramID,
+		ScheduledAt: scheduledAt,
+	})
+}
+
+func (n *NotificationScheduler) findHousehold(ctx context.Context, telegramID int64) (*domain.Household, error) {
+	var h *domain.Household
+
+	err := n.uow.Execute(ctx, func(repo storage.HouseholdRepository) error {
+		var err error
+		h, err = repo.FindByID(ctx, telegramID)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+
+	return h, err
+}
+
+func (n *NotificationScheduler) getSchedules(ctx context.Context) ([]*domain.Household, error) {
+	var households []*domain.Household
+
+	err := n.uow.Execute(ctx, func(repo storage.HouseholdRepository) error {
+		var err error
+		households, err = repo.GetSchedules(ctx)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+
+	return households, err
+}
+
+// firesAt reports whether the household's schedule has a run at t
+func (n *NotificationScheduler) firesAt(ctx context.Context, h *domain.Household, t time.Time) bool {
+	schedule, err := cron.ParseStandard(h.CronSpec())
+	if err != nil {
+		n.logger.ErrorContext(ctx, "failed to parse household schedule", "telegram_id", h.TelegramID, "error", err)
+		return false
 	}
 
-	newJob, err := n.createJob(h)
+	return schedule.Next(t.Add(-time.Second)).Equal(t)
+}
+
+// missedRun returns the latest run of the household's schedule that happened
+// after the last notification, runs more than MaxLateness ago are dropped.
+// Households that were never notified catch up on runs within MaxLateness
+func (n *NotificationScheduler) missedRun(ctx context.Context, h *domain.Household) (time.Time, bool) {
+	schedule, err := cron.ParseStandard(h.CronSpec())
 	if err != nil {
-		n.logger.Error(
-			"failed to register a new household job",
-			"telegram_id", h.TelegramID,
-			"error", err,
-		)
+		n.logger.ErrorContext(ctx, "failed to parse household schedule", "telegram_id", h.TelegramID, "error", err)
+		return time.Time{}, false
+	}
+
+	now := n.clock.Now()
+	since := now.Add(-n.config.MaxLateness)
+	if h.LastNotifiedAt != nil && h.LastNotifiedAt.After(since) {
+		since = *h.LastNotifiedAt
 	}
 
-	n.logger.Info("updated a job", "household", h.TelegramID)
+	var missed time.Time
+	// Next returns zero time for schedules that never fire
+	for next := schedule.Next(since); !next.IsZero() && !next.After(now); next = schedule.Next(next) {
+		missed = next
+	}
 
-	n.householdJobs[h.TelegramID] = newJob
+	return missed, !missed.IsZero()
 }
 
-func (n *NotificationScheduler) createJob(h *domain.Household) (gocron.Job, error) {
-	return n.scheduler.NewJob(
-		gocron.CronJob(h.Crontab, false),
+// createReminderJob schedules the reminder unless it's scheduled already,
+// reminders that are already due are published right away
+func (n *NotificationScheduler) createReminderJob(ctx context.Context, r domain.Reminder) error {
+	if !r.At.After(n.clock.Now()) {
+		events.RemindAssignment.Publish(ctx, n.eventBus, r)
+		return nil
+	}
+
+	tag := reminderTag(r)
+	for _, j := range n.scheduler.Jobs() {
+		if slices.Contains(j.Tags(), tag) {
+			return nil
+		}
+	}
+
+	_, err := n.scheduler.NewJob(
+		gocron.OneTimeJob(gocron.OneTimeJobStartDateTime(r.At)),
 		gocron.NewTask(
-			func(ctx context.Context, h *domain.Household) {
-				n.eventBus.Publish(ctx, "NotifyHousehold", h)
+			func(ctx context.Context, r domain.Reminder) {
+				events.RemindAssignment.Publish(ctx, n.eventBus, r)
 			},
-			h,
+			r,
 		),
+		gocron.WithTags(tag),
+		// removes the job once it has fired
+		gocron.WithLimitedRuns(1),
 	)
+
+	if err != nil {
+		return fmt.Errorf("failed to register a reminder job of assignment %d: %w", r.AssignmentID, err)
+	}
+
+	n.logger.InfoContext(ctx, "created a reminder job", "household", r.HouseholdID, "at", r.At)
+	return nil
 }
 
-func (n *NotificationScheduler) deleteHouseholdJob(ctx context.Context, event eventbus.Event) {
-	h := event.(*domain.Household)
+// restoreReminders schedules reminders of the latest unfinished assignments
+// that are due after since. Reminder jobs only live in memory, so they are
+// restored on start and on reconciliation, which also picks up reminders of
+// assignments created by other processes. Reminders that were sent already
+// are skipped by their claim
+func (n *NotificationScheduler) restoreReminders(ctx context.Context, since time.Time) error {
+	var reminders []domain.Reminder
 
-	job, ok := n.householdJobs[h.TelegramID]
-	if !ok {
-		return
-	}
+	err := n.uow.Execute(ctx, func(repo storage.HouseholdRepository) error {
+		ids, err := repo.LatestAssignmentIDs(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			assignment, err := repo.FindAssignment(ctx, id)
+			if err != nil {
+				return err
+			}
+
+			if assignment.IsCompleted() {
+				continue
+			}
+
+			household, err := repo.FindByID(ctx, assignment.HouseholdID)
+			if errors.Is(err, storage.ErrHouseholdNotFound) {
+				continue
+			}
+
+			if err != nil {
+				return err
+			}
+
+			reminders = append(reminders, assignment.Reminders(household)...)
+		}
+
+		return nil
+	})
 
-	err := n.scheduler.RemoveJob(job.ID())
 	if err != nil {
-		n.logger.Error(
-			"failed to remove old household job",
-			"telegram_id", h.TelegramID,
-			"error", err,
-		)
+		return err
 	}
 
-	delete(n.householdJobs, h.TelegramID)
-	n.logger.Info("deleted a job", "household", h.TelegramID)
+	for _, r := range reminders {
+		if r.At.Before(since) {
+			continue
+		}
+
+		if err := n.createReminderJob(ctx, r); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
@@ -3,18 +3,52 @@ package scheduler
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"log/slog"
+	"slices"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/andrewyazura/duty-reminder/internal/config"
 	"github.com/andrewyazura/duty-reminder/internal/domain"
 	"github.com/andrewyazura/duty-reminder/internal/eventbus"
+	"github.com/andrewyazura/duty-reminder/internal/events"
 	"github.com/andrewyazura/duty-reminder/internal/storage"
+	"github.com/go-co-op/gocron/v2"
+	"github.com/jonboulle/clockwork"
 )
 
+var testConfig = config.SchedulerConfig{MaxLateness: 12 * time.Hour}
+
 type mockHouseholdRepo struct {
-	households []*domain.Household
-	err        error
+	lock        sync.Mutex
+	households  []*domain.Household
+	assignments []*domain.Assignment
+	err         error
+	// beforeRestore runs when the scheduler starts restoring reminders
+	beforeRestore func()
+}
+
+// put adds the household or replaces the one with the same id
+func (repo *mockHouseholdRepo) put(h *domain.Household) {
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	repo.households = slices.DeleteFunc(repo.households, func(stored *domain.Household) bool {
+		return stored.TelegramID == h.TelegramID
+	})
+	repo.households = append(repo.households, h)
+}
+
+func (repo *mockHouseholdRepo) remove(telegramID int64) {
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	repo.households = slices.DeleteFunc(repo.households, func(stored *domain.Household) bool {
+		return stored.TelegramID == telegramID
+	})
 }
 
 func (repo *mockHouseholdRepo) Create(ctx context.Context, h *domain.Household) error { return nil }
@@ -23,11 +57,83 @@ func (repo *mockHouseholdRepo) SaveWithMembers(ctx context.Context, h *domain.Ho
 	return nil
 }
 func (repo *mockHouseholdRepo) FindByID(ctx context.Context, telegramID int64) (*domain.Household, error) {
-	return nil, nil
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	for _, h := range repo.households {
+		if h.TelegramID == telegramID {
+			return h, nil
+		}
+	}
+
+	return nil, storage.ErrHouseholdNotFound
 }
 
 func (repo *mockHouseholdRepo) GetSchedules(ctx context.Context) ([]*domain.Household, error) {
-	return repo.households, repo.err
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	return slices.Clone(repo.households), repo.err
+}
+
+func (repo *mockHouseholdRepo) CreateAssignment(ctx context.Context, a *domain.Assignment) error {
+	return nil
+}
+func (repo *mockHouseholdRepo) SaveAssignment(ctx context.Context, a *domain.Assignment) error {
+	return nil
+}
+func (repo *mockHouseholdRepo) FindAssignment(ctx context.Context, id int64) (*domain.Assignment, error) {
+	for _, a := range repo.assignments {
+		if a.ID == id {
+			return a, nil
+		}
+	}
+
+	return nil, storage.ErrAssignmentNotFound
+}
+func (repo *mockHouseholdRepo) ReassignLatest(ctx context.Context, householdID int64, memberID int64) error {
+	return nil
+}
+func (repo *mockHouseholdRepo) LatestAssignmentIDs(ctx context.Context) ([]int64, error) {
+	if repo.beforeRestore != nil {
+		repo.beforeRestore()
+	}
+
+	var ids []int64
+	for _, a := range repo.assignments {
+		ids = append(ids, a.ID)
+	}
+
+	return ids, nil
+}
+func (repo *mockHouseholdRepo) ClaimReminder(ctx context.Context, r domain.Reminder) (bool, error) {
+	return true, nil
+}
+
+func (repo *mockHouseholdRepo) ClaimOccurrence(ctx context.Context, o domain.Occurrence) (bool, error) {
+	return true, nil
+}
+
+func (repo *mockHouseholdRepo) AddToOutbox(ctx context.Context, eventType string, h *domain.Household, at time.Time) error {
+	return nil
+}
+func (repo *mockHouseholdRepo) ClaimOutbox(ctx context.Context, limit int, at time.Time) ([]storage.OutboxEvent, error) {
+	return nil, nil
+}
+func (repo *mockHouseholdRepo) MarkDispatched(ctx context.Context, ids []int64, at time.Time) error {
+	return nil
+}
+func (repo *mockHouseholdRepo) AddDeadLetter(ctx context.Context, dl *storage.DeadLetter) error {
+	return nil
+}
+func (repo *mockHouseholdRepo) PendingDeadLetters(ctx context.Context, limit int) ([]storage.DeadLetter, error) {
+	return nil, nil
+}
+func (repo *mockHouseholdRepo) FindDeadLetter(ctx context.Context, id int64) (*storage.DeadLetter, error) {
+	return nil, storage.ErrDeadLetterNotFound
+}
+func (repo *mockHouseholdRepo) MarkReplayed(ctx context.Context, id int64, at time.Time) error {
+	return nil
 }
 
 type mockUnitOfWork struct {
@@ -42,6 +148,27 @@ func (m *mockUnitOfWork) ExecuteTransaction(ctx context.Context, fn func(repo st
 	return fn(m.repo)
 }
 
+// findJobs looks household's jobs up in gocron by their tag
+func (n *NotificationScheduler) findJobs(telegramID int64) []gocron.Job {
+	tag := householdTag(telegramID)
+
+	var jobs []gocron.Job
+	for _, j := range n.scheduler.Jobs() {
+		if slices.Contains(j.Tags(), tag) {
+			jobs = append(jobs, j)
+		}
+	}
+
+	return jobs
+}
+
+func (r *jobRegistry) len() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return len(r.jobs)
+}
+
 func TestNew(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
 
@@ -55,7 +182,7 @@ func TestNew(t *testing.T) {
 		}
 		mockUOW := &mockUnitOfWork{repo: mockRepo}
 
-		s, err := New(bus, logger, mockUOW)
+		s, err := New(bus, &testConfig, logger, mockUOW, clockwork.NewRealClock())
 		if err != nil {
 			t.Fatalf("New() returned unexpected error: %v", err)
 		}
@@ -65,8 +192,8 @@ func TestNew(t *testing.T) {
 			t.Errorf("got %d jobs in scheduler, want %d", len(jobs), 2)
 		}
 
-		if len(s.householdJobs) != 2 {
-			t.Errorf("got %d entries in householdJobs, want %d", len(s.householdJobs), 2)
+		if s.householdJobs.len() != 2 {
+			t.Errorf("got %d entries in householdJobs, want %d", s.householdJobs.len(), 2)
 		}
 	})
 
@@ -79,7 +206,7 @@ func TestNew(t *testing.T) {
 		}
 		mockUOW := &mockUnitOfWork{repo: mockRepo}
 
-		_, err := New(bus, logger, mockUOW)
+		_, err := New(bus, &testConfig, logger, mockUOW, clockwork.NewRealClock())
 
 		if err == nil {
 			t.Fatal("New() did not return an error")
@@ -97,16 +224,22 @@ func TestEvents(t *testing.T) {
 	mockRepo := &mockHouseholdRepo{}
 	mockUOW := &mockUnitOfWork{repo: mockRepo}
 
-	s, err := New(bus, logger, mockUOW)
+	s, err := New(bus, &testConfig, logger, mockUOW, clockwork.NewRealClock())
 	if err != nil {
 		t.Fatalf("failed to create scheduler: %v", err)
 	}
 
+	ctx := context.Background()
+	const telegramID = -1234567898765
+
+	// events only carry the id, the rest is reloaded from the repository
+	event := events.HouseholdChanged{HouseholdID: telegramID}
+
 	t.Run("HouseholdCreated", func(t *testing.T) {
 		jobsBefore := len(s.scheduler.Jobs())
-		h := &domain.Household{TelegramID: -1234567898765, Crontab: "0 9 * * *"}
+		mockRepo.put(&domain.Household{TelegramID: telegramID, Crontab: "0 9 * * *"})
 
-		s.createHouseholdJob(context.Background(), h)
+		s.syncHouseholdJob(ctx, event)
 
 		if got := len(s.scheduler.Jobs()); got != jobsBefore+1 {
 			t.Errorf("jobs before: %d, got: %d jobs, want: %d", jobsBefore, got, jobsBefore+1)
@@ -114,17 +247,17 @@ func TestEvents(t *testing.T) {
 	})
 
 	t.Run("HouseholdUpdated", func(t *testing.T) {
-		h := &domain.Household{TelegramID: -1234567898765, Crontab: "0 9 * * *"}
-		s.createHouseholdJob(context.Background(), h)
-		initialJob, ok := s.householdJobs[h.TelegramID]
+		mockRepo.put(&domain.Household{TelegramID: telegramID, Crontab: "0 9 * * *"})
+		s.syncHouseholdJob(ctx, event)
+		initialJob, ok := s.householdJobs.get(telegramID)
 		if !ok {
 			t.Fatal("initial job not created")
 		}
 
-		h.Crontab = "0 2 * * *"
-		s.updateHouseholdJob(context.Background(), h)
+		mockRepo.put(&domain.Household{TelegramID: telegramID, Crontab: "0 2 * * *"})
+		s.syncHouseholdJob(ctx, event)
 
-		updatedJob, ok := s.householdJobs[h.TelegramID]
+		updatedJob, ok := s.householdJobs.get(telegramID)
 		if !ok {
 			t.Fatal("job was removed instead of updated")
 		}
@@ -132,25 +265,705 @@ func TestEvents(t *testing.T) {
 		if updatedJob.ID() == initialJob.ID() {
 			t.Error("job was not updated, ID remained the same")
 		}
+
+		jobs := s.findJobs(telegramID)
+		if len(jobs) != 1 || jobs[0].ID() != updatedJob.ID() {
+			t.Errorf("got %d tagged jobs for the household, want only the updated one", len(jobs))
+		}
+	})
+
+	t.Run("HouseholdUpdatedSameSchedule", func(t *testing.T) {
+		mockRepo.put(&domain.Household{TelegramID: telegramID, Crontab: "0 9 * * *"})
+		s.syncHouseholdJob(ctx, event)
+		initialJob, _ := s.householdJobs.get(telegramID)
+
+		s.syncHouseholdJob(ctx, event)
+
+		if job, _ := s.householdJobs.get(telegramID); job.ID() != initialJob.ID() {
+			t.Error("job was replaced although the schedule didn't change")
+		}
+	})
+
+	t.Run("HouseholdUpdatedInvalidCrontab", func(t *testing.T) {
+		mockRepo.put(&domain.Household{TelegramID: telegramID, Crontab: "0 9 * * *"})
+		s.syncHouseholdJob(ctx, event)
+		initialJob, _ := s.householdJobs.get(telegramID)
+
+		mockRepo.put(&domain.Household{TelegramID: telegramID, Crontab: "invalid"})
+		s.syncHouseholdJob(ctx, event)
+
+		job, ok := s.householdJobs.get(telegramID)
+		if !ok || job.ID() != initialJob.ID() {
+			t.Error("previous job was not kept")
+		}
+
+		if jobs := s.findJobs(telegramID); len(jobs) != 1 {
+			t.Errorf("got %d tagged jobs for the household, want 1", len(jobs))
+		}
+	})
+
+	t.Run("ReminderScheduled", func(t *testing.T) {
+		jobsBefore := len(s.scheduler.Jobs())
+		r := domain.Reminder{
+			AssignmentID: 1,
+			HouseholdID:  telegramID,
+			At:           time.Now().Add(time.Hour),
+		}
+
+		s.createReminderJob(ctx, r)
+
+		if got := len(s.scheduler.Jobs()); got != jobsBefore+1 {
+			t.Errorf("jobs before: %d, got: %d jobs, want: %d", jobsBefore, got, jobsBefore+1)
+		}
 	})
 
 	t.Run("HouseholdDeleted", func(t *testing.T) {
-		h := &domain.Household{TelegramID: -1234567898765, Crontab: "0 9 * * *"}
-		s.createHouseholdJob(context.Background(), h)
+		mockRepo.put(&domain.Household{TelegramID: telegramID, Crontab: "0 9 * * *"})
+		s.syncHouseholdJob(ctx, event)
 		jobsBefore := len(s.scheduler.Jobs())
 
-		if _, ok := s.householdJobs[h.TelegramID]; !ok {
+		if _, ok := s.householdJobs.get(telegramID); !ok {
 			t.Fatal("initial job not created")
 		}
 
-		s.deleteHouseholdJob(context.Background(), h)
+		mockRepo.remove(telegramID)
+		s.syncHouseholdJob(ctx, event)
 
 		if got := len(s.scheduler.Jobs()); got != jobsBefore-1 {
-			t.Errorf("jobs before: %d, got: %d jobs, want: %d", jobsBefore, got, jobsBefore+1)
+			t.Errorf("jobs before: %d, got: %d jobs, want: %d", jobsBefore, got, jobsBefore-1)
 		}
 
-		if _, ok := s.householdJobs[h.TelegramID]; ok {
+		if _, ok := s.householdJobs.get(telegramID); ok {
 			t.Errorf("job was not removed")
 		}
 	})
 }
+
+func TestTimeZone(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	bus := eventbus.NewEventBus(logger)
+	mockRepo := &mockHouseholdRepo{
+		households: []*domain.Household{
+			{TelegramID: 1, Crontab: "0 9 * * *", TimeZone: "Asia/Tokyo"},
+		},
+	}
+	mockUOW := &mockUnitOfWork{repo: mockRepo}
+
+	s, err := New(bus, &testConfig, logger, mockUOW, clockwork.NewRealClock())
+	if err != nil {
+		t.Fatalf("failed to create scheduler: %v", err)
+	}
+
+	s.Start()
+	defer s.Shutdown()
+
+	job, ok := s.householdJobs.get(1)
+	if !ok {
+		t.Fatal("household job not created")
+	}
+
+	nextRun, err := job.NextRun()
+	if err != nil {
+		t.Fatalf("NextRun() returned an error: %v", err)
+	}
+
+	location, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatalf("failed to load location: %v", err)
+	}
+
+	if got := nextRun.In(location); got.Hour() != 9 || got.Minute() != 0 {
+		t.Errorf("next run is at %s in Asia/Tokyo, want 09:00", got.Format("15:04"))
+	}
+}
+
+func TestFakeClock(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	// friday, the household is notified on saturdays at 9:00
+	start := time.Date(2025, time.January, 3, 12, 0, 0, 0, time.UTC)
+
+	newScheduler := func(t *testing.T, households ...*domain.Household) (*eventbus.EventBus, *clockwork.FakeClock, *mockHouseholdRepo) {
+		t.Helper()
+
+		bus := eventbus.NewEventBus(logger)
+		clock := clockwork.NewFakeClockAt(start)
+		mockRepo := &mockHouseholdRepo{households: households}
+		mockUOW := &mockUnitOfWork{repo: mockRepo}
+
+		s, err := New(bus, &testConfig, logger, mockUOW, clock)
+		if err != nil {
+			t.Fatalf("failed to create scheduler: %v", err)
+		}
+
+		s.Start()
+		t.Cleanup(s.Shutdown)
+
+		return bus, clock, mockRepo
+	}
+
+	// advance moves the clock once the scheduler has armed its timers
+	advance := func(t *testing.T, clock *clockwork.FakeClock, d time.Duration) {
+		t.Helper()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		if err := clock.BlockUntilContext(ctx, 1); err != nil {
+			t.Fatalf("scheduler didn't arm a timer: %v", err)
+		}
+
+		clock.Advance(d)
+	}
+
+	expectEvent := func(t *testing.T, fired <-chan time.Time, clock clockwork.Clock, want time.Time) {
+		t.Helper()
+
+		select {
+		case got := <-fired:
+			if !got.Equal(want) {
+				t.Errorf("event published at %s, want %s", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no event published at %s", clock.Now())
+		}
+	}
+
+	expectNoEvent := func(t *testing.T, fired <-chan time.Time) {
+		t.Helper()
+
+		select {
+		case got := <-fired:
+			t.Fatalf("unexpected event published at %s", got)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	t.Run("NotifyHousehold", func(t *testing.T) {
+		bus, clock, _ := newScheduler(t, &domain.Household{TelegramID: 1, Crontab: "0 9 * * 6"})
+
+		fired := make(chan time.Time, 1)
+		events.NotifyHousehold.Subscribe(bus, func(ctx context.Context, o domain.Occurrence) error {
+			fired <- o.ScheduledAt
+			return nil
+		})
+
+		saturday := time.Date(2025, time.January, 4, 9, 0, 0, 0, time.UTC)
+
+		advance(t, clock, saturday.Sub(start)-time.Minute)
+		expectNoEvent(t, fired)
+
+		advance(t, clock, time.Minute)
+		expectEvent(t, fired, clock, saturday)
+
+		advance(t, clock, 7*24*time.Hour-time.Minute)
+		expectNoEvent(t, fired)
+
+		advance(t, clock, time.Minute)
+		expectEvent(t, fired, clock, saturday.AddDate(0, 0, 7))
+	})
+
+	t.Run("TimeZone", func(t *testing.T) {
+		bus, clock, _ := newScheduler(t, &domain.Household{
+			TelegramID: 1,
+			Crontab:    "0 9 * * 6",
+			TimeZone:   "Asia/Tokyo",
+		})
+
+		fired := make(chan time.Time, 1)
+		events.NotifyHousehold.Subscribe(bus, func(ctx context.Context, o domain.Occurrence) error {
+			fired <- o.ScheduledAt
+			return nil
+		})
+
+		// saturday 9:00 in Tokyo is midnight in UTC
+		saturday := time.Date(2025, time.January, 4, 0, 0, 0, 0, time.UTC)
+
+		advance(t, clock, saturday.Sub(start)-time.Minute)
+		expectNoEvent(t, fired)
+
+		advance(t, clock, time.Minute)
+		expectEvent(t, fired, clock, saturday)
+	})
+
+	t.Run("ChangedSchedule", func(t *testing.T) {
+		bus, clock, mockRepo := newScheduler(t, &domain.Household{TelegramID: 1, Crontab: "0 9 * * 6"})
+
+		fired := make(chan time.Time, 1)
+		events.NotifyHousehold.Subscribe(bus, func(ctx context.Context, o domain.Occurrence) error {
+			fired <- o.ScheduledAt
+			return nil
+		})
+
+		// changed by another replica, this one didn't get an event
+		mockRepo.put(&domain.Household{TelegramID: 1, Crontab: "0 10 * * 6"})
+
+		saturday := time.Date(2025, time.January, 4, 9, 0, 0, 0, time.UTC)
+
+		advance(t, clock, saturday.Sub(start))
+		expectNoEvent(t, fired)
+
+		advance(t, clock, time.Hour)
+		expectEvent(t, fired, clock, saturday.Add(time.Hour))
+	})
+
+	t.Run("DeletedHousehold", func(t *testing.T) {
+		bus, clock, mockRepo := newScheduler(t, &domain.Household{TelegramID: 1, Crontab: "0 9 * * 6"})
+
+		fired := make(chan time.Time, 1)
+		events.NotifyHousehold.Subscribe(bus, func(ctx context.Context, o domain.Occurrence) error {
+			fired <- o.ScheduledAt
+			return nil
+		})
+
+		mockRepo.remove(1)
+
+		saturday := time.Date(2025, time.January, 4, 9, 0, 0, 0, time.UTC)
+
+		advance(t, clock, saturday.Sub(start))
+		expectNoEvent(t, fired)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		if err := clock.BlockUntilContext(ctx, 1); err == nil {
+			t.Error("job of a deleted household is still scheduled")
+		}
+	})
+
+	t.Run("RemindAssignment", func(t *testing.T) {
+		bus, clock, _ := newScheduler(t)
+
+		fired := make(chan time.Time, 1)
+		events.RemindAssignment.Subscribe(bus, func(ctx context.Context, r domain.Reminder) error {
+			fired <- clock.Now()
+			return nil
+		})
+
+		at := start.Add(4 * time.Hour)
+		events.ReminderScheduled.Publish(context.Background(), bus, domain.Reminder{
+			AssignmentID: 1,
+			HouseholdID:  1,
+			At:           at,
+		})
+
+		advance(t, clock, 4*time.Hour-time.Second)
+		expectNoEvent(t, fired)
+
+		advance(t, clock, time.Second)
+		expectEvent(t, fired, clock, at)
+	})
+}
+
+func TestConcurrentEvents(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	bus := eventbus.NewEventBus(logger)
+	mockRepo := &mockHouseholdRepo{}
+	mockUOW := &mockUnitOfWork{repo: mockRepo}
+
+	s, err := New(bus, &testConfig, logger, mockUOW, clockwork.NewRealClock())
+	if err != nil {
+		t.Fatalf("failed to create scheduler: %v", err)
+	}
+
+	s.Start()
+	defer s.Shutdown()
+
+	var wg sync.WaitGroup
+	for i := range 300 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// every household goes through every operation
+			id := int64(i / 4 % 3)
+			switch i % 4 {
+			case 0:
+				mockRepo.remove(id)
+			case 1:
+				s.reconcile(context.Background())
+				return
+			default:
+				mockRepo.put(&domain.Household{TelegramID: id, Crontab: fmt.Sprintf("%d 9 * * *", i%60)})
+			}
+
+			s.syncHouseholdJob(context.Background(), events.HouseholdChanged{HouseholdID: id})
+		}()
+	}
+	wg.Wait()
+
+	for id := range int64(3) {
+		jobs := s.findJobs(id)
+		job, ok := s.householdJobs.get(id)
+
+		switch {
+		case len(jobs) > 1:
+			t.Errorf("household %d has %d jobs, want at most 1", id, len(jobs))
+		case ok && len(jobs) == 0:
+			t.Errorf("household %d is registered but has no job in the scheduler", id)
+		case !ok && len(jobs) == 1:
+			t.Errorf("household %d has a job in the scheduler but isn't registered", id)
+		case ok && jobs[0].ID() != job.ID():
+			t.Errorf("household %d is registered with a job that isn't in the scheduler", id)
+		}
+	}
+
+	if n := len(s.householdJobs.locks); n != 0 {
+		t.Errorf("registry kept %d household locks, want none", n)
+	}
+}
+
+func TestCatchUp(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	at := func(day, hour, minute int) *time.Time {
+		t := time.Date(2025, time.January, day, hour, minute, 0, 0, time.UTC)
+		return &t
+	}
+
+	tests := []struct {
+		name      string
+		household *domain.Household
+		now       *time.Time
+		want      bool
+	}{
+		{
+			name:      "missed run",
+			household: &domain.Household{TelegramID: 1, Crontab: "0 9 * * 6", LastNotifiedAt: at(1, 12, 0)},
+			now:       at(4, 9, 30),
+			want:      true,
+		},
+		{
+			name:      "already notified",
+			household: &domain.Household{TelegramID: 1, Crontab: "0 9 * * 6", LastNotifiedAt: at(4, 9, 0)},
+			now:       at(4, 9, 30),
+			want:      false,
+		},
+		{
+			name:      "too late",
+			household: &domain.Household{TelegramID: 1, Crontab: "0 9 * * 6", LastNotifiedAt: at(1, 12, 0)},
+			now:       at(4, 21, 1),
+			want:      false,
+		},
+		{
+			name:      "never notified",
+			household: &domain.Household{TelegramID: 1, Crontab: "0 9 * * 6"},
+			now:       at(4, 9, 30),
+			want:      true,
+		},
+		{
+			name:      "never notified, too late",
+			household: &domain.Household{TelegramID: 1, Crontab: "0 9 * * 6"},
+			now:       at(4, 21, 1),
+			want:      false,
+		},
+		{
+			name: "time zone",
+			household: &domain.Household{
+				TelegramID:     1,
+				Crontab:        "0 9 * * 6",
+				TimeZone:       "Asia/Tokyo",
+				LastNotifiedAt: at(1, 12, 0),
+			},
+			now:  at(4, 0, 30),
+			want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bus := eventbus.NewEventBus(logger)
+			mockUOW := &mockUnitOfWork{repo: &mockHouseholdRepo{households: []*domain.Household{tt.household}}}
+
+			notified := make(chan struct{}, 1)
+			events.NotifyHousehold.Subscribe(bus, func(ctx context.Context, o domain.Occurrence) error {
+				notified <- struct{}{}
+				return nil
+			})
+
+			_, err := New(bus, &testConfig, logger, mockUOW, clockwork.NewFakeClockAt(*tt.now))
+			if err != nil {
+				t.Fatalf("failed to create scheduler: %v", err)
+			}
+
+			select {
+			case <-notified:
+				if !tt.want {
+					t.Error("household was notified, want no catch up")
+				}
+			case <-time.After(50 * time.Millisecond):
+				if tt.want {
+					t.Error("household wasn't notified, want a catch up")
+				}
+			}
+		})
+	}
+}
+
+// TestCatchUpReminders checks that the reminder of a catch up notification
+// isn't published before the scheduler subscribes to it
+func TestCatchUpReminders(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	now := time.Date(2025, time.January, 4, 9, 30, 0, 0, time.UTC)
+	household := &domain.Household{TelegramID: 1, Crontab: "0 9 * * 6"}
+	reminder := domain.Reminder{AssignmentID: 1, HouseholdID: household.TelegramID, At: now.Add(time.Hour)}
+
+	bus := eventbus.NewEventBus(logger)
+
+	// what DutyService does once the household is notified
+	published := make(chan struct{})
+	events.NotifyHousehold.Subscribe(bus, func(ctx context.Context, o domain.Occurrence) error {
+		defer close(published)
+		return events.ReminderScheduled.PublishAndWait(ctx, bus, reminder)
+	})
+
+	// New doesn't get further than catching up until the reminder is published
+	mockRepo := &mockHouseholdRepo{
+		households: []*domain.Household{household},
+		beforeRestore: func() {
+			select {
+			case <-published:
+			case <-time.After(time.Second):
+				t.Error("household wasn't notified, want a catch up")
+			}
+		},
+	}
+
+	s, err := New(bus, &testConfig, logger, &mockUnitOfWork{repo: mockRepo}, clockwork.NewFakeClockAt(now))
+	if err != nil {
+		t.Fatalf("failed to create scheduler: %v", err)
+	}
+
+	scheduled := slices.ContainsFunc(s.scheduler.Jobs(), func(j gocron.Job) bool {
+		return slices.Contains(j.Tags(), reminderTag(reminder))
+	})
+
+	if !scheduled {
+		t.Error("the reminder of the catch up wasn't scheduled")
+	}
+}
+
+func TestRestoreReminders(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	now := time.Date(2025, time.January, 4, 12, 0, 0, 0, time.UTC)
+	household := &domain.Household{
+		TelegramID:      1,
+		Crontab:         "0 9 * * 6",
+		LastNotifiedAt:  &now,
+		ReminderDelay:   2 * time.Hour,
+		EscalationDelay: 6 * time.Hour,
+	}
+
+	assignment := func(id int64, createdAt time.Time, completed bool) *domain.Assignment {
+		item := &domain.AssignmentItem{Position: 0, Name: "dishes"}
+		if completed {
+			item.CompletedAt = &createdAt
+		}
+
+		return &domain.Assignment{
+			ID:          id,
+			HouseholdID: household.TelegramID,
+			CreatedAt:   createdAt,
+			Items:       []*domain.AssignmentItem{item},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		assignment *domain.Assignment
+		want       []domain.Reminder
+	}{
+		{
+			name:       "pending reminders",
+			assignment: assignment(1, now.Add(-time.Hour), false),
+			want: []domain.Reminder{
+				{AssignmentID: 1, HouseholdID: 1, At: now.Add(time.Hour)},
+				{AssignmentID: 1, HouseholdID: 1, At: now.Add(5 * time.Hour), Escalate: true},
+			},
+		},
+		{
+			name:       "due reminders",
+			assignment: assignment(1, now.Add(-3*time.Hour), false),
+			want: []domain.Reminder{
+				{AssignmentID: 1, HouseholdID: 1, At: now.Add(-time.Hour)},
+				{AssignmentID: 1, HouseholdID: 1, At: now.Add(3 * time.Hour), Escalate: true},
+			},
+		},
+		{
+			name:       "too late",
+			assignment: assignment(1, now.Add(-16*time.Hour), false),
+			want: []domain.Reminder{
+				{AssignmentID: 1, HouseholdID: 1, At: now.Add(-10 * time.Hour), Escalate: true},
+			},
+		},
+		{
+			name:       "completed",
+			assignment: assignment(1, now.Add(-time.Hour), true),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bus := eventbus.NewEventBus(logger)
+			clock := clockwork.NewFakeClockAt(now)
+			mockUOW := &mockUnitOfWork{repo: &mockHouseholdRepo{
+				households:  []*domain.Household{household},
+				assignments: []*domain.Assignment{tt.assignment},
+			}}
+
+			reminded := make(chan domain.Reminder, 2)
+			events.RemindAssignment.Subscribe(bus, func(ctx context.Context, r domain.Reminder) error {
+				reminded <- r
+				return nil
+			})
+
+			s, err := New(bus, &testConfig, logger, mockUOW, clock)
+			if err != nil {
+				t.Fatalf("failed to create scheduler: %v", err)
+			}
+
+			s.Start()
+			t.Cleanup(s.Shutdown)
+
+			// the household job and the reminders that are still ahead
+			timers := 1
+			for _, r := range tt.want {
+				if r.At.After(now) {
+					timers++
+				}
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			if err := clock.BlockUntilContext(ctx, timers); err != nil {
+				t.Fatalf("scheduler didn't arm its timers: %v", err)
+			}
+
+			clock.Advance(6 * time.Hour)
+
+			var got []domain.Reminder
+			for range tt.want {
+				select {
+				case r := <-reminded:
+					got = append(got, r)
+				case <-time.After(time.Second):
+					t.Fatalf("reminders %v, want %v", got, tt.want)
+				}
+			}
+
+			select {
+			case r := <-reminded:
+				t.Fatalf("unexpected reminder %v", r)
+			case <-time.After(50 * time.Millisecond):
+			}
+
+			slices.SortFunc(got, func(a, b domain.Reminder) int { return a.At.Compare(b.At) })
+			if !slices.EqualFunc(got, tt.want, func(a, b domain.Reminder) bool {
+				return a.AssignmentID == b.AssignmentID && a.At.Equal(b.At) && a.Escalate == b.Escalate
+			}) {
+				t.Errorf("reminders %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	bus := eventbus.NewEventBus(logger)
+	mockRepo := &mockHouseholdRepo{
+		households: []*domain.Household{
+			{TelegramID: 1, Crontab: "0 9 * * *"},
+			{TelegramID: 2, Crontab: "0 10 * * *"},
+			{TelegramID: 3, Crontab: "0 11 * * *"},
+		},
+	}
+	mockUOW := &mockUnitOfWork{repo: mockRepo}
+
+	s, err := New(bus, &testConfig, logger, mockUOW, clockwork.NewRealClock())
+	if err != nil {
+		t.Fatalf("failed to create scheduler: %v", err)
+	}
+
+	unchanged, _ := s.householdJobs.get(1)
+
+	// changes made directly in the database or by another replica
+	mockRepo.put(&domain.Household{TelegramID: 2, Crontab: "0 12 * * *"})
+	mockRepo.remove(3)
+	mockRepo.put(&domain.Household{TelegramID: 4, Crontab: "0 13 * * *"})
+
+	s.reconcile(context.Background())
+
+	want := map[int64]string{
+		1: "0 9 * * *",
+		2: "0 12 * * *",
+		4: "0 13 * * *",
+	}
+
+	if got := s.householdJobs.len(); got != len(want) {
+		t.Errorf("got %d jobs, want %d", got, len(want))
+	}
+
+	for id, spec := range want {
+		job, ok := s.householdJobs.get(id)
+		if !ok {
+			t.Errorf("household %d has no job", id)
+			continue
+		}
+
+		if job.spec != spec {
+			t.Errorf("household %d runs on %q, want %q", id, job.spec, spec)
+		}
+
+		if jobs := s.findJobs(id); len(jobs) != 1 {
+			t.Errorf("household %d has %d jobs in the scheduler, want 1", id, len(jobs))
+		}
+	}
+
+	if job, _ := s.householdJobs.get(1); job.ID() != unchanged.ID() {
+		t.Error("unchanged household's job was replaced")
+	}
+
+	if jobs := s.findJobs(3); len(jobs) != 0 {
+		t.Errorf("deleted household has %d jobs, want 0", len(jobs))
+	}
+
+	t.Run("reminders", func(t *testing.T) {
+		// an assignment created by another process
+		mockRepo.put(&domain.Household{
+			TelegramID:      1,
+			Crontab:         "0 9 * * *",
+			ReminderDelay:   time.Hour,
+			EscalationDelay: 2 * time.Hour,
+		})
+		mockRepo.assignments = []*domain.Assignment{{
+			ID:          1,
+			HouseholdID: 1,
+			CreatedAt:   time.Now(),
+			Items:       []*domain.AssignmentItem{{Name: "dishes"}},
+		}}
+
+		s.reconcile(context.Background())
+		s.reconcile(context.Background())
+
+		want := []domain.Reminder{
+			{AssignmentID: 1, HouseholdID: 1},
+			{AssignmentID: 1, HouseholdID: 1, Escalate: true},
+		}
+
+		for _, r := range want {
+			var jobs int
+			for _, j := range s.scheduler.Jobs() {
+				if slices.Contains(j.Tags(), reminderTag(r)) {
+					jobs++
+				}
+			}
+
+			if jobs != 1 {
+				t.Errorf("reminder %s has %d jobs, want 1", reminderTag(r), jobs)
+			}
+		}
+	})
+}
@@ -11,6 +11,9 @@ import (
 	"github.com/andrewyazura/duty-reminder/internal/eventbus"
 )
 
+// maxRequestIDLength limits how much of a client's X-Request-Id is logged
+const maxRequestIDLength = 64
+
 type Server struct {
 	config          config.ServerConfig
 	logger          *slog.Logger
@@ -55,10 +58,22 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	s.logger.Debug("incoming request",
+	// the id is passed on to events published while handling the request.
+	// It is always generated, the client's request id is only logged
+	eventID := eventbus.NewEventID()
+	r = r.WithContext(eventbus.WithEventID(r.Context(), eventID))
+	w.Header().Set("X-Event-Id", eventID)
+
+	requestID := r.Header.Get("X-Request-Id")
+	if len(requestID) > maxRequestIDLength {
+		requestID = requestID[:maxRequestIDLength] + "... [truncated]"
+	}
+
+	s.logger.DebugContext(r.Context(), "incoming request",
 		"method", r.Method,
 		"path", r.URL.Path,
 		"remote", r.RemoteAddr,
+		"request_id", requestID,
 		"body", bodyStr,
 	)
 
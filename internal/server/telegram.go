@@ -1,13 +1,13 @@
 package server
 
 import (
-	"context"
 	"encoding/json"
 	"log/slog"
 	"net/http"
 
 	"github.com/andrewyazura/duty-reminder/internal/config"
 	"github.com/andrewyazura/duty-reminder/internal/eventbus"
+	"github.com/andrewyazura/duty-reminder/internal/events"
 	"github.com/andrewyazura/duty-reminder/internal/telegram"
 )
 
@@ -51,6 +51,8 @@ func (h *TelegramWebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	h.eventBus.Publish(context.Background(), "TelegramUpdate", update)
+	// handlers are detached from the request, they keep running after the
+	// response is sent
+	events.TelegramUpdate.Publish(r.Context(), h.eventBus, update)
 	w.WriteHeader(http.StatusOK)
 }
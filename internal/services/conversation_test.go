@@ -0,0 +1,527 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+
+	"github.com/andrewyazura/duty-reminder/internal/domain"
+	"github.com/andrewyazura/duty-reminder/internal/eventbus"
+	"github.com/andrewyazura/duty-reminder/internal/events"
+	"github.com/andrewyazura/duty-reminder/internal/storage"
+	"github.com/andrewyazura/duty-reminder/internal/telegram"
+	"github.com/andrewyazura/duty-reminder/internal/telegram/telegramtest"
+	"github.com/jonboulle/clockwork"
+)
+
+func TestConversation(t *testing.T) {
+	const chatID = -100
+
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	api := telegramtest.NewServer(t)
+	config := api.Config()
+	client := api.NewClient(&config, logger)
+
+	bus := eventbus.NewEventBus(logger)
+	uow := NewMemoryUnitOfWork(storage.NewMemoryHouseholdRepository())
+
+	clock := clockwork.NewFakeClock()
+
+	NewTelegramService(bus, client, &config, logger, uow, clock)
+	NewDutyService(bus, client, &config, logger, uow, clock)
+
+	webhook := api.NewWebhook(bus)
+
+	alice := telegramtest.User(1, "Alice")
+	bob := telegramtest.User(2, "Bob")
+	carol := telegramtest.User(3, "Carol")
+
+	// updates of the chat are handled in order, waiting for the replies keeps
+	// them from interleaving with NotifyHousehold published below
+	send := func(update telegram.Update, replies int) []telegramtest.Call {
+		t.Helper()
+
+		n := len(api.Calls())
+		webhook.Send(t, update)
+		return api.WaitForCalls(t, n+replies)
+	}
+
+	send(telegramtest.BotAdded(chatID, alice), 1)
+	for _, u := range []telegram.User{alice, bob, carol} {
+		send(telegramtest.Command(chatID, u, "/register"), 1)
+	}
+	send(telegramtest.Command(chatID, alice, "/set_checklist\ndishes\nfloor"), 1)
+
+	// what the scheduler does when the household's cron fires
+	n := len(api.Calls())
+	events.NotifyHousehold.Publish(ctx, bus, domain.Occurrence{HouseholdID: chatID, ScheduledAt: clock.Now()})
+	calls := api.WaitForCalls(t, n+2)
+
+	checklist := calls[len(calls)-1]
+	keyboard := checklist.InlineKeyboard()
+	if len(keyboard) != 2 {
+		t.Fatalf("checklist has %d buttons, want 2: %s", len(keyboard), checklist.Payload)
+	}
+
+	dishes := keyboard[0][0].CallbackData
+	floor := keyboard[1][0].CallbackData
+
+	send(telegramtest.Callback(chatID, bob, checklist.MessageID, dishes), 1)
+	send(telegramtest.Callback(chatID, alice, checklist.MessageID, dishes), 2)
+	send(telegramtest.Callback(chatID, alice, checklist.MessageID, dishes), 1)
+	send(telegramtest.Callback(chatID, alice, checklist.MessageID, floor), 3)
+
+	want := []string{
+		"sendMessage -100: Hey! Group chat was successfully added. 🏠\n" +
+			"Your current schedule is 0 9 * * 6 (UTC) 🗓️\n" +
+			"To register as a member, please use /register",
+		"sendMessage -100: ✅ You're in the household now",
+		"sendMessage -100: ✅ You're in the household now",
+		"sendMessage -100: ✅ You're in the household now",
+		"sendMessage -100: ✅ Your household's checklist has been updated",
+		"sendMessage -100: 🧹 It's [Alice](tg://user?id=1)'s turn to clean",
+		"sendMessage -100: List of stuff to complete:",
+		"answerCallbackQuery: 🛑 Only the member on duty can complete this checklist",
+		"answerCallbackQuery",
+		"editMessageReplyMarkup -100",
+		"answerCallbackQuery: ✅ this item is already done",
+		"answerCallbackQuery",
+		"editMessageReplyMarkup -100",
+		"sendMessage -100: 🎉 [Alice](tg://user?id=1) has finished their duty",
+	}
+
+	got := api.Transcript()
+	if !slices.Equal(got, want) {
+		t.Errorf("unexpected conversation\ngot:\n%q\nwant:\n%q", got, want)
+	}
+}
+
+// TestConversationOrder sends updates without waiting for replies, every chat
+// must still see them handled in the order they were sent
+func TestConversationOrder(t *testing.T) {
+	const rounds = 10
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	api := telegramtest.NewServer(t)
+	config := api.Config()
+	client := api.NewClient(&config, logger)
+
+	bus := eventbus.NewEventBus(logger)
+	uow := NewMemoryUnitOfWork(storage.NewMemoryHouseholdRepository())
+
+	NewTelegramService(bus, client, &config, logger, uow, clockwork.NewFakeClock())
+	webhook := api.NewWebhook(bus)
+
+	alice := telegramtest.User(1, "Alice")
+	chats := []int64{-100, -200}
+
+	for _, chatID := range chats {
+		webhook.Send(t, telegramtest.BotAdded(chatID, alice))
+	}
+	api.WaitForCalls(t, len(chats))
+
+	for range rounds {
+		for _, chatID := range chats {
+			webhook.Send(t, telegramtest.Command(chatID, alice, "/register"))
+			webhook.Send(t, telegramtest.Command(chatID, alice, "/leave"))
+		}
+	}
+
+	calls := api.WaitForCalls(t, len(chats)*(1+2*rounds))
+
+	for _, chatID := range chats {
+		var got []string
+		for _, c := range calls {
+			if c.ChatID == chatID {
+				got = append(got, c.Text)
+			}
+		}
+
+		want := []string{got[0]}
+		for range rounds {
+			want = append(want, "✅ You're in the household now", "👋 You've left the household")
+		}
+
+		if !slices.Equal(got, want) {
+			t.Errorf("chat %d got replies out of order\ngot:\n%q\nwant:\n%q", chatID, got, want)
+		}
+	}
+}
+
+func TestOutdatedCallbacks(t *testing.T) {
+	const chatID = -100
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	api := telegramtest.NewServer(t)
+	config := api.Config()
+	client := api.NewClient(&config, logger)
+
+	bus := eventbus.NewEventBus(logger)
+	uow := NewMemoryUnitOfWork(storage.NewMemoryHouseholdRepository())
+
+	NewTelegramService(bus, client, &config, logger, uow, clockwork.NewFakeClock())
+	webhook := api.NewWebhook(bus)
+
+	alice := telegramtest.User(1, "Alice")
+	webhook.Send(t, telegramtest.BotAdded(chatID, alice))
+	api.WaitForCalls(t, 1)
+
+	for i, data := range []string{
+		"update_checklist:999:0",
+		"update_checklist:dishes",
+		"order_up:alice",
+		"something_else",
+	} {
+		webhook.Send(t, telegramtest.Callback(chatID, alice, 1, data))
+		api.WaitForCalls(t, i+2)
+	}
+
+	// an order keyboard left in a group that isn't a household anymore
+	api.SetAdmin(alice.ID)
+	n := len(api.Calls())
+	webhook.Send(t, telegramtest.Callback(-200, alice, 1, "order_up:1"))
+	api.WaitForCalls(t, n+2)
+
+	want := []string{
+		"answerCallbackQuery: ⚠️ This checklist is outdated",
+		"answerCallbackQuery: ⚠️ This checklist is outdated",
+		"answerCallbackQuery: ⚠️ This list is outdated",
+		"answerCallbackQuery",
+		"answerCallbackQuery: ⚠️ This group isn't a household yet, run /start first",
+	}
+
+	got := api.Transcript()[1:]
+	if !slices.Equal(got, want) {
+		t.Errorf("unexpected replies\ngot:\n%q\nwant:\n%q", got, want)
+	}
+}
+
+func TestSkipConversation(t *testing.T) {
+	const chatID = -100
+
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	api := telegramtest.NewServer(t)
+	config := api.Config()
+	client := api.NewClient(&config, logger)
+
+	bus := eventbus.NewEventBus(logger)
+	uow := NewMemoryUnitOfWork(storage.NewMemoryHouseholdRepository())
+
+	clock := clockwork.NewFakeClock()
+
+	NewTelegramService(bus, client, &config, logger, uow, clock)
+	NewDutyService(bus, client, &config, logger, uow, clock)
+
+	webhook := api.NewWebhook(bus)
+
+	alice := telegramtest.User(1, "Alice")
+	bob := telegramtest.User(2, "Bob")
+
+	send := func(update telegram.Update, replies int) []telegramtest.Call {
+		t.Helper()
+
+		n := len(api.Calls())
+		webhook.Send(t, update)
+		return api.WaitForCalls(t, n+replies)
+	}
+
+	send(telegramtest.BotAdded(chatID, alice), 1)
+	for _, u := range []telegram.User{alice, bob} {
+		send(telegramtest.Command(chatID, u, "/register"), 1)
+	}
+	send(telegramtest.Command(chatID, alice, "/set_checklist\ndishes"), 1)
+
+	n := len(api.Calls())
+	events.NotifyHousehold.Publish(ctx, bus, domain.Occurrence{HouseholdID: chatID, ScheduledAt: clock.Now()})
+	calls := api.WaitForCalls(t, n+2)
+
+	checklist := calls[len(calls)-1]
+	dishes := checklist.InlineKeyboard()[0][0].CallbackData
+
+	api.Reset()
+
+	send(telegramtest.Command(chatID, alice, "/skip"), 1)
+	send(telegramtest.Callback(chatID, alice, checklist.MessageID, dishes), 1)
+	send(telegramtest.Callback(chatID, bob, checklist.MessageID, dishes), 3)
+
+	want := []string{
+		"sendMessage -100: ⏭️ [Alice](tg://user?id=1) was skipped, it's [Bob](tg://user?id=2)'s turn to clean now",
+		"answerCallbackQuery: 🛑 Only the member on duty can complete this checklist",
+		"answerCallbackQuery",
+		"editMessageReplyMarkup -100",
+		"sendMessage -100: 🎉 [Bob](tg://user?id=2) has finished their duty",
+	}
+
+	got := api.Transcript()
+	if !slices.Equal(got, want) {
+		t.Errorf("unexpected conversation\ngot:\n%q\nwant:\n%q", got, want)
+	}
+}
+
+func TestRemoveConversation(t *testing.T) {
+	const chatID = -100
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	api := telegramtest.NewServer(t)
+	config := api.Config()
+	client := api.NewClient(&config, logger)
+
+	bus := eventbus.NewEventBus(logger)
+	uow := NewMemoryUnitOfWork(storage.NewMemoryHouseholdRepository())
+
+	NewTelegramService(bus, client, &config, logger, uow, clockwork.NewFakeClock())
+	webhook := api.NewWebhook(bus)
+
+	alice := telegramtest.User(1, "Alice")
+	bob := telegramtest.User(2, "Bob")
+	bob.Username = "bob"
+	carol := telegramtest.User(3, "Carol")
+	dave := telegramtest.User(4, "Dave")
+
+	// replies count getChatMember calls of the admin check too
+	send := func(update telegram.Update, replies int) {
+		t.Helper()
+
+		n := len(api.Calls())
+		webhook.Send(t, update)
+		api.WaitForCalls(t, n+replies)
+	}
+
+	send(telegramtest.BotAdded(chatID, alice), 1)
+	for _, u := range []telegram.User{alice, bob, carol, dave} {
+		send(telegramtest.Command(chatID, u, "/register"), 1)
+	}
+
+	api.SetAdmin(alice.ID)
+	api.Reset()
+
+	send(telegramtest.Command(chatID, bob, "/remove @bob"), 2)
+	send(telegramtest.Command(chatID, alice, "/remove"), 2)
+	send(telegramtest.Command(chatID, alice, "/remove @BOB"), 2)
+	send(telegramtest.Command(chatID, alice, "/remove @bob"), 2)
+	send(telegramtest.Command(chatID, carol, "/leave"), 1)
+	send(telegramtest.Command(chatID, carol, "/leave"), 1)
+	send(telegramtest.MemberLeft(chatID, dave), 1)
+
+	// nobody to remove, so no reply
+	webhook.Send(t, telegramtest.MemberLeft(chatID, carol))
+	send(telegramtest.Command(chatID, alice, "/order"), 1)
+
+	want := []string{
+		"sendMessage -100: 🛑 Only group admins can remove members",
+		"sendMessage -100: ⚠️ You didn't specify who to remove. Correct usage:\n\n/remove @user",
+		"sendMessage -100: 🗑️ [Bob](tg://user?id=2) was removed from the household",
+		"sendMessage -100: 🤷 This user is not a member of the household",
+		"sendMessage -100: 👋 You've left the household",
+		"sendMessage -100: 🤷 You are not a member of this household",
+		"sendMessage -100: 👋 [Dave](tg://user?id=4) has left the household",
+		"sendMessage -100: 🔃 Current order of members, 👉 marks the next one on duty:",
+	}
+
+	got := api.Transcript()
+	if !slices.Equal(got, want) {
+		t.Errorf("unexpected conversation\ngot:\n%q\nwant:\n%q", got, want)
+	}
+
+	calls := api.Calls()
+	keyboard := calls[len(calls)-1].InlineKeyboard()
+	if len(keyboard) != 1 || keyboard[0][0].Text != "👉 Alice" {
+		t.Errorf("got order keyboard %v, want only Alice", keyboard)
+	}
+}
+
+func TestOrderConversation(t *testing.T) {
+	const chatID = -100
+
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	api := telegramtest.NewServer(t)
+	config := api.Config()
+	client := api.NewClient(&config, logger)
+
+	bus := eventbus.NewEventBus(logger)
+	uow := NewMemoryUnitOfWork(storage.NewMemoryHouseholdRepository())
+
+	clock := clockwork.NewFakeClock()
+
+	NewTelegramService(bus, client, &config, logger, uow, clock)
+	NewDutyService(bus, client, &config, logger, uow, clock)
+
+	webhook := api.NewWebhook(bus)
+
+	alice := telegramtest.User(1, "Alice")
+	bob := telegramtest.User(2, "Bob")
+	carol := telegramtest.User(3, "Carol")
+
+	// replies count getChatMember calls of the admin check too
+	send := func(update telegram.Update, replies int) []telegramtest.Call {
+		t.Helper()
+
+		n := len(api.Calls())
+		webhook.Send(t, update)
+		return api.WaitForCalls(t, n+replies)
+	}
+
+	names := func(keyboard telegram.InlineKeyboard) []string {
+		var result []string
+		for _, row := range keyboard {
+			result = append(result, row[0].Text)
+		}
+		return result
+	}
+
+	send(telegramtest.BotAdded(chatID, alice), 1)
+	for _, u := range []telegram.User{alice, bob, carol} {
+		send(telegramtest.Command(chatID, u, "/register"), 1)
+	}
+
+	// alice is on duty, bob is next
+	n := len(api.Calls())
+	events.NotifyHousehold.Publish(ctx, bus, domain.Occurrence{HouseholdID: chatID, ScheduledAt: clock.Now()})
+	api.WaitForCalls(t, n+1)
+
+	api.SetAdmin(alice.ID)
+	api.Reset()
+
+	calls := send(telegramtest.Command(chatID, alice, "/order"), 1)
+	order := calls[len(calls)-1]
+
+	if got, want := names(order.InlineKeyboard()), []string{"Alice", "👉 Bob", "Carol"}; !slices.Equal(got, want) {
+		t.Fatalf("got order %v, want %v", got, want)
+	}
+
+	up := func(id int64) string { return fmt.Sprintf("order_up:%d", id) }
+	down := func(id int64) string { return fmt.Sprintf("order_down:%d", id) }
+
+	send(telegramtest.Callback(chatID, bob, order.MessageID, up(carol.ID)), 2)
+
+	calls = send(telegramtest.Callback(chatID, alice, order.MessageID, up(carol.ID)), 3)
+	if got, want := names(calls[len(calls)-1].InlineKeyboard()), []string{"Alice", "Carol", "👉 Bob"}; !slices.Equal(got, want) {
+		t.Errorf("got order %v after moving Carol up, want %v", got, want)
+	}
+
+	send(telegramtest.Callback(chatID, alice, order.MessageID, down(bob.ID)), 2)
+
+	calls = send(telegramtest.Callback(chatID, alice, order.MessageID, down(alice.ID)), 3)
+	if got, want := names(calls[len(calls)-1].InlineKeyboard()), []string{"Carol", "Alice", "👉 Bob"}; !slices.Equal(got, want) {
+		t.Errorf("got order %v after moving Alice down, want %v", got, want)
+	}
+
+	calls = send(telegramtest.Callback(chatID, alice, order.MessageID, down(carol.ID)), 3)
+	if got, want := names(calls[len(calls)-1].InlineKeyboard()), []string{"Alice", "Carol", "👉 Bob"}; !slices.Equal(got, want) {
+		t.Errorf("got order %v after moving Carol down, want %v", got, want)
+	}
+
+	// reordering doesn't change who is on duty
+	send(telegramtest.Command(chatID, alice, "/skip"), 1)
+
+	want := []string{
+		"sendMessage -100: 🔃 Current order of members, 👉 marks the next one on duty:",
+		"answerCallbackQuery: 🛑 Only group admins can change the order",
+		"answerCallbackQuery",
+		"editMessageReplyMarkup -100",
+		"answerCallbackQuery: 🤷 Can't move this member any further",
+		"answerCallbackQuery",
+		"editMessageReplyMarkup -100",
+		"answerCallbackQuery",
+		"editMessageReplyMarkup -100",
+		"sendMessage -100: ⏭️ [Alice](tg://user?id=1) was skipped, it's [Bob](tg://user?id=2)'s turn to clean now",
+	}
+
+	got := api.Transcript()
+	if !slices.Equal(got, want) {
+		t.Errorf("unexpected conversation\ngot:\n%q\nwant:\n%q", got, want)
+	}
+}
+
+func TestTimeZoneConversation(t *testing.T) {
+	const chatID = -100
+
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	api := telegramtest.NewServer(t)
+	config := api.Config()
+	client := api.NewClient(&config, logger)
+
+	bus := eventbus.NewEventBus(logger)
+	uow := NewMemoryUnitOfWork(storage.NewMemoryHouseholdRepository())
+
+	NewTelegramService(bus, client, &config, logger, uow, clockwork.NewFakeClock())
+	webhook := api.NewWebhook(bus)
+
+	alice := telegramtest.User(1, "Alice")
+
+	send := func(text string) {
+		t.Helper()
+
+		n := len(api.Calls())
+		webhook.Send(t, telegramtest.Command(chatID, alice, text))
+		api.WaitForCalls(t, n+1)
+	}
+
+	schedule := func() string {
+		t.Helper()
+
+		var household *domain.Household
+		err := uow.Execute(ctx, func(repo storage.HouseholdRepository) error {
+			var err error
+			household, err = repo.FindByID(ctx, chatID)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("FindByID() failed: %v", err)
+		}
+
+		return household.CronSpec()
+	}
+
+	webhook.Send(t, telegramtest.BotAdded(chatID, alice))
+	api.WaitForCalls(t, 1)
+	api.Reset()
+
+	for _, c := range []struct {
+		text     string
+		schedule string
+	}{
+		{"/set_schedule CRON_TZ=Europe/Kyiv 0 10 * * 6", "CRON_TZ=Europe/Kyiv 0 10 * * 6"},
+		{"/set_schedule 0 9 * * 5", "CRON_TZ=Europe/Kyiv 0 9 * * 5"},
+		{"/set_schedule TZ=America/New_York 0 8 * * 0", "CRON_TZ=America/New_York 0 8 * * 0"},
+		{"/set_schedule TZ=Mars/Olympus 0 8 * * 0", "CRON_TZ=America/New_York 0 8 * * 0"},
+		{"/set_schedule CRON_TZ=Europe/Kyiv", "CRON_TZ=America/New_York 0 8 * * 0"},
+		{"/set_timezone Europe/Kyiv", "CRON_TZ=Europe/Kyiv 0 8 * * 0"},
+		{"/set_timezone Mars/Olympus", "CRON_TZ=Europe/Kyiv 0 8 * * 0"},
+	} {
+		send(c.text)
+
+		if got := schedule(); got != c.schedule {
+			t.Errorf("got schedule %q after %q, want %q", got, c.text, c.schedule)
+		}
+	}
+
+	want := []string{
+		"sendMessage -100: ✅ Your household's schedule has been updated",
+		"sendMessage -100: ✅ Your household's schedule has been updated",
+		"sendMessage -100: ✅ Your household's schedule has been updated",
+		"sendMessage -100: ⚠️ The time zone you've provided is invalid. Correct example:\n\n/set_schedule CRON_TZ=Europe/Kyiv 0 9 * * 5",
+		"sendMessage -100: ⚠️ The schedule you've provided is invalid. Correct example:\n\n/set_schedule 0 9 * * 5",
+		"sendMessage -100: ✅ Your household's time zone has been set to Europe/Kyiv",
+		"sendMessage -100: ⚠️ The time zone you've provided is invalid. Correct example:\n\n/set_timezone Europe/Kyiv",
+	}
+
+	got := api.Transcript()
+	if !slices.Equal(got, want) {
+		t.Errorf("unexpected conversation\ngot:\n%q\nwant:\n%q", got, want)
+	}
+}
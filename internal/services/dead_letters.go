@@ -0,0 +1,116 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/andrewyazura/duty-reminder/internal/eventbus"
+	"github.com/andrewyazura/duty-reminder/internal/storage"
+	"github.com/jonboulle/clockwork"
+)
+
+// DeadLetters keeps events whose handlers ran out of attempts in the
+// database and replays them on request
+type DeadLetters struct {
+	bus    *eventbus.EventBus
+	clock  clockwork.Clock
+	logger *slog.Logger
+	uow    UnitOfWork
+}
+
+// NewDeadLetters creates the store and sets it as the bus' dead letter store
+func NewDeadLetters(
+	bus *eventbus.EventBus,
+	logger *slog.Logger,
+	uow UnitOfWork,
+	clock clockwork.Clock,
+) *DeadLetters {
+	d := &DeadLetters{
+		bus:    bus,
+		clock:  clock,
+		logger: logger,
+		uow:    uow,
+	}
+
+	bus.SetDeadLetterStore(d)
+	return d
+}
+
+func (d *DeadLetters) AddDeadLetter(ctx context.Context, dl eventbus.DeadLetter) error {
+	return d.uow.Execute(ctx, func(repo storage.HouseholdRepository) error {
+		err := repo.AddDeadLetter(ctx, &storage.DeadLetter{
+			EventType:  string(dl.EventType),
+			Subscriber: dl.Subscriber,
+			Payload:    dl.Payload,
+			Error:      dl.Error,
+			Attempts:   dl.Attempts,
+			FailedAt:   d.clock.Now(),
+		})
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
+
+// Pending returns dead letters that weren't replayed yet, oldest first
+func (d *DeadLetters) Pending(ctx context.Context, limit int) ([]storage.DeadLetter, error) {
+	var letters []storage.DeadLetter
+
+	err := d.uow.Execute(ctx, func(repo storage.HouseholdRepository) error {
+		var err error
+		letters, err = repo.PendingDeadLetters(ctx, limit)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+
+	return letters, err
+}
+
+// Replay runs the dead letter's subscriber again. The dead letter is marked
+// as replayed only if the subscriber succeeds
+func (d *DeadLetters) Replay(ctx context.Context, id int64) error {
+	var dl *storage.DeadLetter
+
+	err := d.uow.Execute(ctx, func(repo storage.HouseholdRepository) error {
+		var err error
+		dl, err = repo.FindDeadLetter(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	err = d.bus.Replay(ctx, eventbus.DeadLetter{
+		ID:         dl.ID,
+		EventType:  eventbus.EventType(dl.EventType),
+		Subscriber: dl.Subscriber,
+		Payload:    dl.Payload,
+		Error:      dl.Error,
+		Attempts:   dl.Attempts,
+		FailedAt:   dl.FailedAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	d.logger.InfoContext(ctx, "dead letter replayed", "id", id, "event", dl.EventType, "subscriber", dl.Subscriber)
+
+	return d.uow.Execute(ctx, func(repo storage.HouseholdRepository) error {
+		err := repo.MarkReplayed(ctx, id, d.clock.Now())
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/andrewyazura/duty-reminder/internal/eventbus"
+	"github.com/andrewyazura/duty-reminder/internal/events"
+	"github.com/andrewyazura/duty-reminder/internal/storage"
+	"github.com/jonboulle/clockwork"
+)
+
+func TestDeadLetters(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	bus := eventbus.NewEventBus(logger)
+	uow := NewMemoryUnitOfWork(storage.NewMemoryHouseholdRepository())
+	clock := clockwork.NewFakeClock()
+
+	deadLetters := NewDeadLetters(bus, logger, uow, clock)
+
+	var failing atomic.Bool
+	failing.Store(true)
+
+	received := make(chan int64, 1)
+	events.HouseholdCreated.Subscribe(bus, func(ctx context.Context, e events.HouseholdChanged) error {
+		if failing.Load() {
+			return errors.New("handler failed")
+		}
+
+		received <- e.HouseholdID
+		return nil
+	}, eventbus.WithName("test"), eventbus.WithRetry(eventbus.RetryPolicy{MaxAttempts: 2}))
+
+	events.HouseholdCreated.Publish(ctx, bus, events.HouseholdChanged{HouseholdID: -100})
+
+	var pending []storage.DeadLetter
+	for deadline := time.Now().Add(time.Second); len(pending) == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("event wasn't moved to dead letters")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+
+		var err error
+		pending, err = deadLetters.Pending(ctx, 10)
+		if err != nil {
+			t.Fatalf("Pending() failed: %v", err)
+		}
+	}
+
+	dl := pending[0]
+	if dl.EventType != "HouseholdCreated" || dl.Subscriber != "test" || dl.Attempts != 2 || !dl.FailedAt.Equal(clock.Now()) {
+		t.Errorf("got dead letter %+v", dl)
+	}
+
+	t.Run("failed replay", func(t *testing.T) {
+		if err := deadLetters.Replay(ctx, dl.ID); err == nil {
+			t.Fatal("Replay() of a failing handler succeeded")
+		}
+
+		if pending, _ := deadLetters.Pending(ctx, 10); len(pending) != 1 {
+			t.Errorf("got %d pending dead letters, want 1", len(pending))
+		}
+	})
+
+	t.Run("replay", func(t *testing.T) {
+		failing.Store(false)
+
+		if err := deadLetters.Replay(ctx, dl.ID); err != nil {
+			t.Fatalf("Replay() failed: %v", err)
+		}
+
+		if got := <-received; got != -100 {
+			t.Errorf("handler got household %d, want -100", got)
+		}
+
+		if pending, _ := deadLetters.Pending(ctx, 10); len(pending) != 0 {
+			t.Errorf("got %d pending dead letters after replay, want 0", len(pending))
+		}
+
+		if err := deadLetters.Replay(ctx, dl.ID); !errors.Is(err, storage.ErrDeadLetterNotFound) {
+			t.Errorf("got error %v, want %v", err, storage.ErrDeadLetterNotFound)
+		}
+	})
+}
@@ -2,17 +2,33 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"strings"
+	"time"
 
 	"github.com/andrewyazura/duty-reminder/internal/config"
 	"github.com/andrewyazura/duty-reminder/internal/domain"
 	"github.com/andrewyazura/duty-reminder/internal/eventbus"
+	"github.com/andrewyazura/duty-reminder/internal/events"
 	"github.com/andrewyazura/duty-reminder/internal/storage"
 	"github.com/andrewyazura/duty-reminder/internal/telegram"
+	"github.com/jonboulle/clockwork"
 )
 
+// dutyRetryPolicy covers database hiccups. Handlers only send messages once
+// their claim has committed and don't fail after that, so a retry never
+// repeats a message
+var dutyRetryPolicy = eventbus.RetryPolicy{
+	MaxAttempts:    5,
+	InitialBackoff: time.Second,
+	MaxBackoff:     time.Minute,
+}
+
 type DutyService struct {
+	bus    *eventbus.EventBus
+	clock  clockwork.Clock
 	config *config.TelegramConfig
 	client *telegram.Client
 	logger *slog.Logger
@@ -21,27 +37,59 @@ type DutyService struct {
 
 func NewDutyService(
 	bus *eventbus.EventBus,
+	client *telegram.Client,
 	config *config.TelegramConfig,
 	logger *slog.Logger,
 	uow UnitOfWork,
+	clock clockwork.Clock,
 ) *DutyService {
 	s := &DutyService{
+		bus:    bus,
+		clock:  clock,
 		config: config,
-		client: telegram.NewClient(config, logger),
+		client: client,
 		logger: logger,
 		uow:    uow,
 	}
 
-	bus.Subscribe("NotifyHousehold", s.NotifyHousehold)
+	events.NotifyHousehold.Subscribe(
+		bus,
+		s.NotifyHousehold,
+		eventbus.WithName("DutyService.NotifyHousehold"),
+		eventbus.WithRetry(dutyRetryPolicy),
+	)
+	events.RemindAssignment.Subscribe(
+		bus,
+		s.RemindAssignment,
+		eventbus.WithName("DutyService.RemindAssignment"),
+		eventbus.WithRetry(dutyRetryPolicy),
+	)
 	return s
 }
 
-func (s DutyService) NotifyHousehold(ctx context.Context, event eventbus.Event) {
-	h := event.(*domain.Household)
+// NotifyHousehold rotates the duty and creates its assignment. They are
+// committed together with the occurrence's claim before the household is
+// told, so retries and other replicas never repeat the messages
+func (s DutyService) NotifyHousehold(ctx context.Context, o domain.Occurrence) error {
+	var claimed bool
+	var household *domain.Household
+	var onDuty *domain.Member
+	var assignment *domain.Assignment
 
 	err := s.uow.ExecuteTransaction(ctx, func(repo storage.HouseholdRepository) error {
-		household, err := repo.FindByID(ctx, h.TelegramID)
+		// claiming first makes other replicas wait for this transaction
+		// before they read the household
+		var err error
+		claimed, err = repo.ClaimOccurrence(ctx, o)
+		if err != nil {
+			return err
+		}
 
+		if !claimed {
+			return nil
+		}
+
+		household, err = repo.FindByID(ctx, o.HouseholdID)
 		if err != nil {
 			return err
 		}
@@ -50,49 +98,167 @@ func (s DutyService) NotifyHousehold(ctx context.Context, event eventbus.Event)
 			return nil
 		}
 
-		m := household.PopCurrentMember()
+		onDuty = household.PopCurrentMember()
+
+		now := s.clock.Now()
+		household.LastNotifiedAt = &now
+
+		assignment = domain.NewAssignment(household, onDuty, now)
+
+		err = repo.CreateAssignment(ctx, assignment)
+		if err != nil {
+			return err
+		}
+
+		err = repo.SaveWithMembers(ctx, household)
+
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+
+	if errors.Is(err, storage.ErrHouseholdNotFound) {
+		s.logger.WarnContext(ctx, "skipping notification of a missing household", "telegram_id", o.HouseholdID)
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if !claimed {
+		s.logger.InfoContext(
+			ctx,
+			"skipping notification handled by another instance",
+			"telegram_id", o.HouseholdID,
+			"scheduled_at", o.ScheduledAt,
+		)
+		return nil
+	}
+
+	if onDuty == nil {
+		return nil
+	}
+
+	s.client.SendMessage(
+		household.TelegramID,
+		fmt.Sprintf("🧹 It's %s's turn to clean", mention(onDuty)),
+	).WithParseMode("markdown").Execute(ctx)
+
+	if len(assignment.Items) > 0 {
 		s.client.SendMessage(
 			household.TelegramID,
-			fmt.Sprintf(
-				"🧹 It's [%s](tg://user?id=%d)'s turn to clean",
-				m.Name,
-				m.TelegramID,
-			),
-		).WithParseMode("markdown").Execute(ctx)
+			"List of stuff to complete:",
+		).WithInlineKeyboardMarkup(checklistKeyboard(assignment)).Execute(ctx)
+	}
 
-		if checklist := household.Checklist; checklist != nil {
-			keyboard := telegram.InlineKeyboard{}
-
-			for _, item := range checklist {
-				keyboard = append(keyboard,
-					[]*telegram.InlineKeyboardButton{
-						{
-							Text: item,
-							CallbackData: fmt.Sprintf(
-								"update_checklist:%s",
-								item,
-							),
-						},
-					},
-				)
-			}
-
-			s.client.SendMessage(
-				household.TelegramID,
-				"List of stuff to complete:",
-			).WithInlineKeyboardMarkup(keyboard).Execute(ctx)
+	for _, r := range assignment.Reminders(household) {
+		events.ReminderScheduled.Publish(ctx, s.bus, r)
+	}
+
+	return nil
+}
+
+// RemindAssignment pings the household about an unfinished assignment. The
+// reminder is claimed and committed before it is sent, so neither replicas
+// that scheduled it too nor retries repeat it
+func (s DutyService) RemindAssignment(ctx context.Context, r domain.Reminder) error {
+	var household *domain.Household
+	var onDuty *domain.Member
+
+	err := s.uow.ExecuteTransaction(ctx, func(repo storage.HouseholdRepository) error {
+		claimed, err := repo.ClaimReminder(ctx, r)
+		if err != nil {
+			return err
 		}
 
-		err = repo.SaveWithMembers(ctx, household)
+		if !claimed {
+			s.logger.InfoContext(
+				ctx,
+				"skipping reminder that was already sent",
+				"assignment_id", r.AssignmentID,
+				"escalate", r.Escalate,
+			)
+			return nil
+		}
 
+		assignment, err := repo.FindAssignment(ctx, r.AssignmentID)
 		if err != nil {
 			return err
 		}
 
+		if assignment.IsCompleted() {
+			return nil
+		}
+
+		household, err = repo.FindByID(ctx, r.HouseholdID)
+		if err != nil {
+			return err
+		}
+
+		// the duty has moved on to someone else since
+		onDuty = household.OnDutyMember()
+		if onDuty == nil || onDuty.TelegramID != assignment.MemberID {
+			onDuty = nil
+		}
+
 		return nil
 	})
 
+	if errors.Is(err, storage.ErrHouseholdNotFound) || errors.Is(err, storage.ErrAssignmentNotFound) {
+		s.logger.WarnContext(ctx, "skipping reminder of a missing household or assignment", "telegram_id", r.HouseholdID)
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if onDuty == nil {
+		return nil
+	}
+
+	// the reminder is claimed already, a retry wouldn't send it
+	err = s.sendReminder(ctx, household, onDuty, r.Escalate)
 	if err != nil {
-		s.logger.Error("something went wrong", "error", err)
+		s.logger.ErrorContext(
+			ctx,
+			"failed to send a reminder",
+			"assignment_id", r.AssignmentID,
+			"escalate", r.Escalate,
+			"error", err,
+		)
 	}
+
+	return nil
+}
+
+func (s DutyService) sendReminder(
+	ctx context.Context,
+	household *domain.Household,
+	onDuty *domain.Member,
+	escalate bool,
+) error {
+	if !escalate {
+		return s.client.SendMessage(
+			household.TelegramID,
+			fmt.Sprintf("⏰ %s, don't forget to finish your duty", mention(onDuty)),
+		).WithParseMode("markdown").Execute(ctx)
+	}
+
+	mentions := make([]string, 0, len(household.Members))
+	for _, m := range household.Members {
+		mentions = append(mentions, mention(m))
+	}
+
+	return s.client.SendMessage(
+		household.TelegramID,
+		fmt.Sprintf(
+			"🚨 %s still hasn't finished their duty\n%s",
+			mention(onDuty),
+			strings.Join(mentions, " "),
+		),
+	).WithParseMode("markdown").Execute(ctx)
 }
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/andrewyazura/duty-reminder/internal/domain"
+	"github.com/andrewyazura/duty-reminder/internal/eventbus"
+	"github.com/andrewyazura/duty-reminder/internal/storage"
+	"github.com/andrewyazura/duty-reminder/internal/telegram/telegramtest"
+	"github.com/jonboulle/clockwork"
+)
+
+func TestNotifyHouseholdOnce(t *testing.T) {
+	const chatID = -100
+
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	api := telegramtest.NewServer(t)
+	config := api.Config()
+	client := api.NewClient(&config, logger)
+	uow := NewMemoryUnitOfWork(storage.NewMemoryHouseholdRepository())
+	clock := clockwork.NewFakeClock()
+
+	err := uow.ExecuteTransaction(ctx, func(repo storage.HouseholdRepository) error {
+		h := domain.NewHousehold(chatID)
+		h.AddMember(&domain.Member{Name: "Alice", TelegramID: 1})
+		h.AddMember(&domain.Member{Name: "Bob", TelegramID: 2})
+
+		if err := repo.Create(ctx, h); err != nil {
+			return err
+		}
+
+		return repo.SaveWithMembers(ctx, h)
+	})
+	if err != nil {
+		t.Fatalf("failed to create a household: %v", err)
+	}
+
+	// replicas share the database but not the event bus
+	replicas := []*DutyService{
+		NewDutyService(eventbus.NewEventBus(logger), client, &config, logger, uow, clock),
+		NewDutyService(eventbus.NewEventBus(logger), client, &config, logger, uow, clock),
+	}
+
+	occurrence := domain.Occurrence{HouseholdID: chatID, ScheduledAt: clock.Now()}
+
+	var wg sync.WaitGroup
+	for _, r := range slices.Concat(replicas, replicas) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.NotifyHousehold(ctx, occurrence)
+		}()
+	}
+	wg.Wait()
+
+	want := []string{"sendMessage -100: 🧹 It's [Alice](tg://user?id=1)'s turn to clean"}
+	if got := api.Transcript(); !slices.Equal(got, want) {
+		t.Errorf("got transcript %q, want %q", got, want)
+	}
+
+	var h *domain.Household
+	err = uow.Execute(ctx, func(repo storage.HouseholdRepository) error {
+		h, err = repo.FindByID(ctx, chatID)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("failed to find the household: %v", err)
+	}
+
+	if h.CurrentMember != 1 {
+		t.Errorf("got current member %d, want 1", h.CurrentMember)
+	}
+
+	t.Run("next occurrence", func(t *testing.T) {
+		api.Reset()
+
+		next := domain.Occurrence{HouseholdID: chatID, ScheduledAt: occurrence.ScheduledAt.AddDate(0, 0, 7)}
+		replicas[1].NotifyHousehold(ctx, next)
+
+		want := []string{"sendMessage -100: 🧹 It's [Bob](tg://user?id=2)'s turn to clean"}
+		if got := api.Transcript(); !slices.Equal(got, want) {
+			t.Errorf("got transcript %q, want %q", got, want)
+		}
+	})
+}
+
+func TestRemindAssignmentOnce(t *testing.T) {
+	const chatID = -100
+
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	api := telegramtest.NewServer(t)
+	config := api.Config()
+	client := api.NewClient(&config, logger)
+	uow := NewMemoryUnitOfWork(storage.NewMemoryHouseholdRepository())
+	clock := clockwork.NewFakeClock()
+
+	err := uow.ExecuteTransaction(ctx, func(repo storage.HouseholdRepository) error {
+		h := domain.NewHousehold(chatID)
+		h.AddMember(&domain.Member{Name: "Alice", TelegramID: 1})
+		h.Checklist = []string{"dishes"}
+
+		if err := repo.Create(ctx, h); err != nil {
+			return err
+		}
+
+		return repo.SaveWithMembers(ctx, h)
+	})
+	if err != nil {
+		t.Fatalf("failed to create a household: %v", err)
+	}
+
+	// replicas share the database but not the event bus
+	replicas := []*DutyService{
+		NewDutyService(eventbus.NewEventBus(logger), client, &config, logger, uow, clock),
+		NewDutyService(eventbus.NewEventBus(logger), client, &config, logger, uow, clock),
+	}
+
+	err = replicas[0].NotifyHousehold(ctx, domain.Occurrence{HouseholdID: chatID, ScheduledAt: clock.Now()})
+	if err != nil {
+		t.Fatalf("failed to notify the household: %v", err)
+	}
+
+	var ids []int64
+	err = uow.Execute(ctx, func(repo storage.HouseholdRepository) error {
+		ids, err = repo.LatestAssignmentIDs(ctx)
+		return err
+	})
+	if err != nil || len(ids) != 1 {
+		t.Fatalf("failed to find the assignment: %v %v", ids, err)
+	}
+
+	api.Reset()
+
+	reminder := domain.Reminder{AssignmentID: ids[0], HouseholdID: chatID, At: clock.Now()}
+
+	var wg sync.WaitGroup
+	for _, r := range slices.Concat(replicas, replicas) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.RemindAssignment(ctx, reminder)
+		}()
+	}
+	wg.Wait()
+
+	want := []string{"sendMessage -100: ⏰ [Alice](tg://user?id=1), don't forget to finish your duty"}
+	if got := api.Transcript(); !slices.Equal(got, want) {
+		t.Errorf("got transcript %q, want %q", got, want)
+	}
+}
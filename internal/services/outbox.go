@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/andrewyazura/duty-reminder/internal/eventbus"
+	"github.com/andrewyazura/duty-reminder/internal/events"
+	"github.com/andrewyazura/duty-reminder/internal/storage"
+	"github.com/jonboulle/clockwork"
+)
+
+const (
+	outboxPollInterval = time.Second
+	outboxBatchSize    = 100
+)
+
+// OutboxDispatcher publishes events from the outbox to the event bus. An event
+// is marked as dispatched only after its handlers succeeded, so it is
+// delivered at least once and handlers have to be idempotent. Events whose
+// handlers keep failing are given up on after a few claims
+type OutboxDispatcher struct {
+	bus    *eventbus.EventBus
+	clock  clockwork.Clock
+	logger *slog.Logger
+	uow    UnitOfWork
+}
+
+func NewOutboxDispatcher(
+	bus *eventbus.EventBus,
+	logger *slog.Logger,
+	uow UnitOfWork,
+	clock clockwork.Clock,
+) *OutboxDispatcher {
+	return &OutboxDispatcher{
+		bus:    bus,
+		clock:  clock,
+		logger: logger,
+		uow:    uow,
+	}
+}
+
+// Run dispatches pending events until the context is cancelled
+func (d *OutboxDispatcher) Run(ctx context.Context) {
+	ticker := d.clock.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			n, err := d.Dispatch(ctx)
+			if err != nil {
+				d.logger.ErrorContext(ctx, "failed to dispatch outbox events", "error", err)
+			}
+
+			// a full batch means there may be more waiting
+			if err != nil || n < outboxBatchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.Chan():
+		}
+	}
+}
+
+// Dispatch claims one batch of pending events, publishes them and waits for
+// their handlers, then returns how many events were dispatched. The claim is
+// committed before publishing, so no rows stay locked while handlers run.
+// Events whose handlers failed are published again once their claim expires
+func (d *OutboxDispatcher) Dispatch(ctx context.Context) (int, error) {
+	var claimed []storage.OutboxEvent
+
+	err := d.uow.ExecuteTransaction(ctx, func(repo storage.HouseholdRepository) error {
+		var err error
+		claimed, err = repo.ClaimOutbox(ctx, outboxBatchSize, d.clock.Now())
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	var ids []int64
+	for _, e := range claimed {
+		// unknown events are marked as dispatched too, so they don't
+		// block the outbox forever
+		topic, ok := events.HouseholdTopic(e.Type)
+		if !ok {
+			d.logger.ErrorContext(ctx, "unknown outbox event", "id", e.ID, "event", e.Type)
+			ids = append(ids, e.ID)
+			continue
+		}
+
+		err := topic.PublishAndWait(ctx, d.bus, events.HouseholdChanged{HouseholdID: e.HouseholdID})
+		if err != nil {
+			d.logger.ErrorContext(ctx, "outbox event handlers failed", "id", e.ID, "event", e.Type, "attempts", e.Attempts, "error", err)
+			continue
+		}
+
+		ids = append(ids, e.ID)
+	}
+
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	err = d.uow.ExecuteTransaction(ctx, func(repo storage.HouseholdRepository) error {
+		return repo.MarkDispatched(ctx, ids, d.clock.Now())
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return len(ids), nil
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/andrewyazura/duty-reminder/internal/domain"
+	"github.com/andrewyazura/duty-reminder/internal/eventbus"
+	"github.com/andrewyazura/duty-reminder/internal/events"
+	"github.com/andrewyazura/duty-reminder/internal/storage"
+	"github.com/andrewyazura/duty-reminder/internal/telegram/telegramtest"
+	"github.com/jonboulle/clockwork"
+)
+
+func TestOutboxDispatcher(t *testing.T) {
+	const chatID = -100
+
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	api := telegramtest.NewServer(t)
+	config := api.Config()
+	client := api.NewClient(&config, logger)
+
+	bus := eventbus.NewEventBus(logger)
+	uow := NewMemoryUnitOfWork(storage.NewMemoryHouseholdRepository())
+	clock := clockwork.NewFakeClock()
+
+	NewTelegramService(bus, client, &config, logger, uow, clock)
+	dispatcher := NewOutboxDispatcher(bus, logger, uow, clock)
+	webhook := api.NewWebhook(bus)
+
+	type published struct {
+		eventType   string
+		householdID int64
+	}
+
+	errFailed := errors.New("handler failed")
+	var failing atomic.Bool
+
+	received := make(chan published, 10)
+	for _, topic := range []eventbus.Topic[events.HouseholdChanged]{events.HouseholdCreated, events.HouseholdCrontabUpdated} {
+		topic.Subscribe(bus, func(ctx context.Context, e events.HouseholdChanged) error {
+			if failing.Load() {
+				return errFailed
+			}
+
+			received <- published{topic.String(), e.HouseholdID}
+			return nil
+		})
+	}
+
+	expectEvents := func(t *testing.T, want ...published) {
+		t.Helper()
+
+		n, err := dispatcher.Dispatch(ctx)
+		if err != nil {
+			t.Fatalf("Dispatch() failed: %v", err)
+		}
+
+		if n != len(want) {
+			t.Fatalf("dispatched %d events, want %d", n, len(want))
+		}
+
+		// every handler runs in its own goroutine, so the order isn't kept
+		got := make(map[published]int)
+		for range want {
+			select {
+			case e := <-received:
+				got[e]++
+			case <-time.After(time.Second):
+				t.Fatalf("got %d events, want %d", len(got), len(want))
+			}
+		}
+
+		for _, e := range want {
+			if got[e] == 0 {
+				t.Errorf("event %+v wasn't published", e)
+			}
+			got[e]--
+		}
+	}
+
+	user := telegramtest.User(1, "Alice")
+
+	webhook.Send(t, telegramtest.BotAdded(chatID, user))
+	api.WaitForCalls(t, 1)
+
+	webhook.Send(t, telegramtest.Command(chatID, user, "/set_schedule 0 10 * * 6"))
+	api.WaitForCalls(t, 2)
+
+	expectEvents(t,
+		published{"HouseholdCreated", chatID},
+		published{"HouseholdCrontabUpdated", chatID},
+	)
+
+	t.Run("dispatched only once", func(t *testing.T) {
+		expectEvents(t)
+	})
+
+	t.Run("rolled back", func(t *testing.T) {
+		want := errors.New("something failed")
+
+		err := uow.ExecuteTransaction(ctx, func(repo storage.HouseholdRepository) error {
+			if err := repo.AddToOutbox(ctx, events.HouseholdCrontabUpdated.String(), domain.NewHousehold(chatID), clock.Now()); err != nil {
+				return err
+			}
+
+			return want
+		})
+		if !errors.Is(err, want) {
+			t.Fatalf("got error %v, want %v", err, want)
+		}
+
+		expectEvents(t)
+	})
+
+	t.Run("failed handler retries the event once its claim expires", func(t *testing.T) {
+		err := uow.ExecuteTransaction(ctx, func(repo storage.HouseholdRepository) error {
+			return repo.AddToOutbox(ctx, events.HouseholdCrontabUpdated.String(), domain.NewHousehold(chatID), clock.Now())
+		})
+		if err != nil {
+			t.Fatalf("AddToOutbox() failed: %v", err)
+		}
+
+		failing.Store(true)
+		expectEvents(t)
+
+		failing.Store(false)
+		expectEvents(t)
+
+		clock.Advance(time.Hour)
+		expectEvents(t, published{"HouseholdCrontabUpdated", chatID})
+	})
+}
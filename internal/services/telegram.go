@@ -6,18 +6,38 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/andrewyazura/duty-reminder/internal/config"
 	"github.com/andrewyazura/duty-reminder/internal/domain"
 	"github.com/andrewyazura/duty-reminder/internal/eventbus"
+	"github.com/andrewyazura/duty-reminder/internal/events"
 	"github.com/andrewyazura/duty-reminder/internal/storage"
 	"github.com/andrewyazura/duty-reminder/internal/telegram"
+	"github.com/jonboulle/clockwork"
 	"github.com/robfig/cron/v3"
 )
 
+// Commands is the list of commands shown by /help and in the bot's menu
+var Commands = []telegram.BotCommand{
+	{Command: "start", Description: "set up this group as a household"},
+	{Command: "register", Description: "become a member of the household"},
+	{Command: "set_schedule", Description: "change household's schedule"},
+	{Command: "set_timezone", Description: "change household's time zone"},
+	{Command: "set_checklist", Description: "change household's checklist"},
+	{Command: "set_deadline", Description: "change when to remind about an unfinished checklist"},
+	{Command: "skip", Description: "pass the duty to the next member, add 'swap' to take their turn instead"},
+	{Command: "leave", Description: "leave the household"},
+	{Command: "remove", Description: "remove a member from the household (admins only)"},
+	{Command: "order", Description: "change the order of members (admins only)"},
+	{Command: "help", Description: "show this list of commands"},
+}
+
 type TelegramService struct {
 	bus    *eventbus.EventBus
+	clock  clockwork.Clock
 	config *config.TelegramConfig
 	client *telegram.Client
 	logger *slog.Logger
@@ -26,40 +46,63 @@ type TelegramService struct {
 
 func NewTelegramService(
 	bus *eventbus.EventBus,
+	client *telegram.Client,
 	config *config.TelegramConfig,
 	logger *slog.Logger,
 	uow UnitOfWork,
+	clock clockwork.Clock,
 ) *TelegramService {
 	s := &TelegramService{
 		bus:    bus,
+		clock:  clock,
 		config: config,
-		client: telegram.NewClient(config, logger),
+		client: client,
 		logger: logger,
 		uow:    uow,
 	}
 
-	bus.Subscribe("TelegramUpdate", s.HandleUpdate)
+	// updates aren't retried, commands reply with their own errors and
+	// running them twice would reply twice. Updates of a chat are handled in
+	// order, so commands don't overwrite each other's changes to a household
+	events.TelegramUpdate.Subscribe(
+		bus,
+		s.HandleUpdate,
+		eventbus.WithName("TelegramService.HandleUpdate"),
+		eventbus.WithKey(chatKey),
+	)
 
 	return s
 }
 
+// chatKey answers updates of a chat in the order they came in. It only
+// orders them within this process, concurrent changes from other replicas
+// and services are serialized by FindByID and FindAssignment locking the
+// household's and the assignment's rows
+func chatKey(update telegram.Update) string {
+	id := update.ChatID()
+	if id == 0 {
+		return ""
+	}
+
+	return strconv.FormatInt(id, 10)
+}
+
 func (s *TelegramService) HandleUpdate(
 	ctx context.Context,
-	event eventbus.Event,
-) {
-	update := event.(telegram.Update)
-	s.logger.Debug("update received", "update", update)
+	update telegram.Update,
+) error {
+	s.logger.DebugContext(ctx, "update received", "update", update)
 
 	if callbackQuery := update.CallbackQuery; callbackQuery != nil {
 		s.handleCallbackQuery(ctx, callbackQuery)
-		return
+		return nil
 	}
 
 	message := update.Message
 
 	if t := message.Chat.Type; t != "group" && t != "supergroup" {
 		s.client.SendMessage(message.Chat.ID, "🛑 Sorry, I only work in groups").Execute(ctx)
-		return
+		return nil
 	}
 
 	// someone was added to a group
@@ -68,19 +111,29 @@ func (s *TelegramService) HandleUpdate(
 			// new member is the bot itself
 			if m.ID == s.config.BotID {
 				s.handleNewGroup(ctx, message)
-				return
+				return nil
 			}
 		}
 	}
 
+	// someone left or was removed from a group
+	if leftMember := message.LeftChatMember; leftMember != nil {
+		if leftMember.ID != s.config.BotID {
+			s.handleLeftMember(ctx, message, leftMember)
+		}
+		return nil
+	}
+
 	if message.Entities != nil {
 		for _, e := range message.Entities {
 			if e.Type == "bot_command" {
 				s.handleCommand(ctx, message, &e)
-				return
+				return nil
 			}
 		}
 	}
+
+	return nil
 }
 
 func (s *TelegramService) handleCallbackQuery(
@@ -89,45 +142,196 @@ func (s *TelegramService) handleCallbackQuery(
 ) {
 	data := callbackQuery.Data
 
-	if strings.HasPrefix(data, "update_checklist") {
-		message := callbackQuery.Message
-		keyboard := message.ReplyMarkup.InlineKeyboard
+	// every callback has to be answered, or the client keeps showing a spinner
+	switch {
+	case strings.HasPrefix(data, "update_checklist"):
+		s.handleChecklistCallback(ctx, callbackQuery)
+	// checklists sent before assignments were persisted mark done items with
+	// this data, those messages are still in the chats
+	case strings.HasPrefix(data, "completed_item"):
+		s.client.AnswerCallbackQuery(callbackQuery.ID).WithText("✅ this item is already done").Execute(ctx)
+	case strings.HasPrefix(data, "order_"):
+		s.handleOrderCallback(ctx, callbackQuery)
+	default:
+		s.client.AnswerCallbackQuery(callbackQuery.ID).Execute(ctx)
+	}
+}
 
-		for _, row := range keyboard {
-			if row[0].CallbackData == data {
-				row[0].Text = fmt.Sprintf("✅ %s", row[0].Text)
-				row[0].CallbackData = "completed_item"
-				break
-			}
-		}
+func (s *TelegramService) handleChecklistCallback(
+	ctx context.Context,
+	callbackQuery *telegram.CallbackQuery,
+) {
+	message := callbackQuery.Message
 
-		s.client.EditMessageReplyMarkup(
-			message.Chat.ID,
-			message.MessageID,
-		).WithInlineKeyboardMarkup(keyboard).Execute(ctx)
+	var assignmentID int64
+	var position int
+	if _, err := fmt.Sscanf(callbackQuery.Data, "update_checklist:%d:%d", &assignmentID, &position); err != nil {
+		s.logger.ErrorContext(ctx, "invalid checklist callback data", "data", callbackQuery.Data, "error", err)
+		s.client.AnswerCallbackQuery(callbackQuery.ID).WithText("⚠️ This checklist is outdated").Execute(ctx)
+		return
 	}
 
-	if strings.HasPrefix(data, "completed_item") {
+	var assignment *domain.Assignment
+	err := s.uow.ExecuteTransaction(ctx, func(repo storage.HouseholdRepository) error {
+		var err error
+		assignment, err = repo.FindAssignment(ctx, assignmentID)
+		if err != nil {
+			return err
+		}
+
+		if assignment.HouseholdID != message.Chat.ID {
+			return domain.ErrItemNotFound
+		}
+
+		err = assignment.CompleteItem(position, callbackQuery.From.ID, s.clock.Now())
+		if err != nil {
+			return err
+		}
+
+		err = repo.SaveAssignment(ctx, assignment)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+
+	switch {
+	case errors.Is(err, domain.ErrNotAssignee):
+		s.client.AnswerCallbackQuery(callbackQuery.ID).
+			WithText("🛑 Only the member on duty can complete this checklist").
+			Execute(ctx)
+		return
+	case errors.Is(err, domain.ErrItemAlreadyCompleted):
 		s.client.AnswerCallbackQuery(callbackQuery.ID).WithText("✅ this item is already done").Execute(ctx)
+		return
+	case errors.Is(err, domain.ErrItemNotFound), errors.Is(err, storage.ErrAssignmentNotFound):
+		s.client.AnswerCallbackQuery(callbackQuery.ID).WithText("⚠️ This checklist is outdated").Execute(ctx)
+		return
+	case err != nil:
+		s.logger.ErrorContext(ctx, "failed to update a checklist", "assignment_id", assignmentID, "error", err)
+		s.client.AnswerCallbackQuery(callbackQuery.ID).WithText("⚠️ Something went wrong, try again").Execute(ctx)
+		return
+	}
+
+	s.client.AnswerCallbackQuery(callbackQuery.ID).Execute(ctx)
+	s.client.EditMessageReplyMarkup(
+		message.Chat.ID,
+		message.MessageID,
+	).WithInlineKeyboardMarkup(checklistKeyboard(assignment)).Execute(ctx)
+
+	if assignment.IsCompleted() {
+		finisher := &domain.Member{
+			Name:       callbackQuery.From.FirstName,
+			TelegramID: callbackQuery.From.ID,
+		}
+
+		s.client.SendMessage(
+			message.Chat.ID,
+			fmt.Sprintf("🎉 %s has finished their duty", mention(finisher)),
+		).WithParseMode("markdown").Execute(ctx)
 	}
 }
 
-func (s *TelegramService) handleNewGroup(
+func (s *TelegramService) handleOrderCallback(
 	ctx context.Context,
-	message *telegram.Message,
+	callbackQuery *telegram.CallbackQuery,
 ) {
+	message := callbackQuery.Message
+
+	action, rawID, _ := strings.Cut(callbackQuery.Data, ":")
+	var offset int
+	switch action {
+	case "order_up":
+		offset = -1
+	case "order_down":
+		offset = 1
+	default:
+		s.client.AnswerCallbackQuery(callbackQuery.ID).Execute(ctx)
+		return
+	}
+
+	memberID, err := strconv.ParseInt(rawID, 10, 64)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "invalid order callback data", "data", callbackQuery.Data, "error", err)
+		s.client.AnswerCallbackQuery(callbackQuery.ID).WithText("⚠️ This list is outdated").Execute(ctx)
+		return
+	}
+
+	isAdmin, err := s.isAdmin(ctx, message.Chat.ID, callbackQuery.From.ID)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "failed to check admin rights", "user_id", callbackQuery.From.ID, "error", err)
+		s.client.AnswerCallbackQuery(callbackQuery.ID).WithText("⚠️ Something went wrong, try again").Execute(ctx)
+		return
+	}
+
+	if !isAdmin {
+		s.client.AnswerCallbackQuery(callbackQuery.ID).
+			WithText("🛑 Only group admins can change the order").
+			WithShowAlert(true).
+			Execute(ctx)
+		return
+	}
+
 	var household *domain.Household
+	moved := false
 
-	err := s.uow.ExecuteTransaction(ctx, func(repo storage.HouseholdRepository) error {
-		_, err := repo.FindByID(ctx, message.Chat.ID)
+	err = s.uow.ExecuteTransaction(ctx, func(repo storage.HouseholdRepository) error {
+		household, err = repo.FindByID(ctx, message.Chat.ID)
+		if err != nil {
+			return err
+		}
 
-		if err == nil {
+		moved = household.MoveMember(memberID, offset)
+		if !moved {
 			return nil
 		}
 
-		household = domain.NewHousehold(message.Chat.ID)
+		err = repo.SaveWithMembers(ctx, household)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+
+	switch {
+	case errors.Is(err, storage.ErrHouseholdNotFound):
+		s.client.AnswerCallbackQuery(callbackQuery.ID).
+			WithText("⚠️ This group isn't a household yet, run /start first").
+			Execute(ctx)
+		return
+	case err != nil:
+		s.logger.ErrorContext(ctx, "failed to move a member", "member_id", memberID, "error", err)
+		s.client.AnswerCallbackQuery(callbackQuery.ID).WithText("⚠️ Something went wrong, try again").Execute(ctx)
+		return
+	}
+
+	if !moved {
+		s.client.AnswerCallbackQuery(callbackQuery.ID).WithText("🤷 Can't move this member any further").Execute(ctx)
+		return
+	}
+
+	s.client.AnswerCallbackQuery(callbackQuery.ID).Execute(ctx)
+	s.client.EditMessageReplyMarkup(
+		message.Chat.ID,
+		message.MessageID,
+	).WithInlineKeyboardMarkup(orderKeyboard(household)).Execute(ctx)
+}
+
+func (s *TelegramService) handleNewGroup(
+	ctx context.Context,
+	message *telegram.Message,
+) {
+	household := domain.NewHousehold(message.Chat.ID)
+
+	err := s.uow.ExecuteTransaction(ctx, func(repo storage.HouseholdRepository) error {
+		err := repo.Create(ctx, household)
+		if err != nil {
+			return err
+		}
 
-		err = repo.Create(ctx, household)
+		err = repo.AddToOutbox(ctx, events.HouseholdCreated.String(), household, s.clock.Now())
 		if err != nil {
 			return err
 		}
@@ -135,20 +339,56 @@ func (s *TelegramService) handleNewGroup(
 		return nil
 	})
 
+	if errors.Is(err, storage.ErrHouseholdExists) {
+		s.client.SendMessage(
+			message.Chat.ID,
+			"👌 This group is already a household, use /help to see what I can do",
+		).Execute(ctx)
+		return
+	}
+
 	if err != nil {
-		s.logger.Error("something went wrong", "error", err)
+		s.logger.ErrorContext(ctx, "something went wrong", "error", err)
 		return
 	}
 
-	s.bus.Publish(ctx, "HouseholdCreated", household)
 	s.client.SendMessage(message.Chat.ID, fmt.Sprintf(
 		`Hey! Group chat was successfully added. 🏠
-Your current schedule is %s 🗓️
+Your current schedule is %s (%s) 🗓️
 To register as a member, please use /register`,
 		household.Crontab,
+		household.TimeZone,
 	)).Execute(ctx)
 }
 
+func (s *TelegramService) handleLeftMember(
+	ctx context.Context,
+	message *telegram.Message,
+	user *telegram.User,
+) {
+	removed, err := s.removeMember(ctx, message.Chat.ID, func(h *domain.Household) *domain.Member {
+		return h.FindMember(user.ID)
+	})
+
+	if errors.Is(err, storage.ErrHouseholdNotFound) {
+		return
+	}
+
+	if err != nil {
+		s.logger.ErrorContext(ctx, "something went wrong", "error", err)
+		return
+	}
+
+	if removed == nil {
+		return
+	}
+
+	s.client.SendMessage(
+		message.Chat.ID,
+		fmt.Sprintf("👋 %s has left the household", mention(removed)),
+	).WithParseMode("markdown").Execute(ctx)
+}
+
 func (s *TelegramService) handleCommand(
 	ctx context.Context,
 	message *telegram.Message,
@@ -157,16 +397,28 @@ func (s *TelegramService) handleCommand(
 	command := entity.Text(message)
 
 	switch command {
+	case "start":
+		s.handleNewGroup(ctx, message)
 	case "register":
 		s.register(ctx, message)
 	case "set_schedule":
 		s.setSchedule(ctx, message)
+	case "set_timezone":
+		s.setTimeZone(ctx, message)
 	case "set_checklist":
 		s.setChecklist(ctx, message)
+	case "set_deadline":
+		s.setDeadline(ctx, message)
 	case "help":
 		s.help(ctx, message)
 	case "skip":
 		s.skip(ctx, message)
+	case "leave":
+		s.leave(ctx, message)
+	case "remove":
+		s.remove(ctx, message)
+	case "order":
+		s.order(ctx, message)
 	default:
 		s.unknownCommand(ctx, message)
 	}
@@ -198,7 +450,8 @@ func (s *TelegramService) register(
 
 		member := &domain.Member{
 			TelegramID: user.ID,
-			Name:       user.FirstName + " " + user.LastName,
+			Name:       strings.TrimSpace(user.FirstName + " " + user.LastName),
+			Username:   user.Username,
 		}
 
 		household.AddMember(member)
@@ -212,7 +465,7 @@ func (s *TelegramService) register(
 	})
 
 	if err != nil {
-		s.logger.Error("something went wrong", "error", err)
+		s.replyError(ctx, message.Chat.ID, err)
 		return
 	}
 
@@ -239,12 +492,24 @@ func (s *TelegramService) setSchedule(
 	}
 
 	newCrontab := strings.Join(parts[1:], " ")
-	s.logger.Debug(
+	s.logger.DebugContext(
+		ctx,
 		"new crontab provided",
 		"chat_id", message.Chat.ID,
 		"crontab", newCrontab,
 	)
 
+	newTimeZone, newCrontab, hasTimeZone := splitTimeZone(newCrontab)
+	if hasTimeZone && !isValidTimeZone(newTimeZone) {
+		s.client.SendMessage(
+			message.Chat.ID,
+			`⚠️ The time zone you've provided is invalid. Correct example:
+
+/set_schedule CRON_TZ=Europe/Kyiv 0 9 * * 5`,
+		).Execute(ctx)
+		return
+	}
+
 	cronParser := cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
 	if _, err := cronParser.Parse(newCrontab); err != nil {
 		s.client.SendMessage(
@@ -256,26 +521,32 @@ func (s *TelegramService) setSchedule(
 		return
 	}
 
-	var household *domain.Household
 	err := s.uow.ExecuteTransaction(ctx, func(repo storage.HouseholdRepository) error {
-		var err error
-		household, err = repo.FindByID(ctx, message.Chat.ID)
+		household, err := repo.FindByID(ctx, message.Chat.ID)
 		if err != nil {
 			return err
 		}
 
 		household.Crontab = newCrontab
+		if hasTimeZone {
+			household.TimeZone = newTimeZone
+		}
 
 		err = repo.Save(ctx, household)
 		if err != nil {
 			return err
 		}
 
+		err = repo.AddToOutbox(ctx, events.HouseholdCrontabUpdated.String(), household, s.clock.Now())
+		if err != nil {
+			return err
+		}
+
 		return nil
 	})
 
 	if err != nil {
-		s.logger.Error("something went wrong", "error", err)
+		s.replyError(ctx, message.Chat.ID, err)
 		return
 	}
 
@@ -284,7 +555,66 @@ func (s *TelegramService) setSchedule(
 		"✅ Your household's schedule has been updated",
 	).Execute(ctx)
 
-	s.bus.Publish(ctx, "HouseholdCrontabUpdated", household)
+}
+
+func (s *TelegramService) setTimeZone(
+	ctx context.Context,
+	message *telegram.Message,
+) {
+	parts := strings.Fields(message.Text)
+
+	if len(parts) == 1 {
+		s.client.SendMessage(
+			message.Chat.ID,
+			`⚠️ You didn't provide any arguments. Correct usage:
+
+/set_timezone Europe/Kyiv`,
+		).Execute(ctx)
+		return
+	}
+
+	newTimeZone := parts[1]
+	if !isValidTimeZone(newTimeZone) {
+		s.client.SendMessage(
+			message.Chat.ID,
+			`⚠️ The time zone you've provided is invalid. Correct example:
+
+/set_timezone Europe/Kyiv`,
+		).Execute(ctx)
+		return
+	}
+
+	err := s.uow.ExecuteTransaction(ctx, func(repo storage.HouseholdRepository) error {
+		household, err := repo.FindByID(ctx, message.Chat.ID)
+		if err != nil {
+			return err
+		}
+
+		household.TimeZone = newTimeZone
+
+		err = repo.Save(ctx, household)
+		if err != nil {
+			return err
+		}
+
+		err = repo.AddToOutbox(ctx, events.HouseholdCrontabUpdated.String(), household, s.clock.Now())
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		s.replyError(ctx, message.Chat.ID, err)
+		return
+	}
+
+	s.client.SendMessage(
+		message.Chat.ID,
+		fmt.Sprintf("✅ Your household's time zone has been set to %s", newTimeZone),
+	).Execute(ctx)
+
 }
 
 func (s *TelegramService) setChecklist(
@@ -324,7 +654,7 @@ item two`,
 	})
 
 	if err != nil {
-		s.logger.Error("something went wrong", "error", err)
+		s.replyError(ctx, message.Chat.ID, err)
 		return
 	}
 
@@ -334,21 +664,416 @@ item two`,
 	).Execute(ctx)
 }
 
-func (s *TelegramService) help(ctx context.Context, message *telegram.Message) {
+// maxDeadlineHours keeps deadlines within a week, which also keeps them
+// far from overflowing time.Duration
+const maxDeadlineHours = 7 * 24
+
+func (s *TelegramService) setDeadline(
+	ctx context.Context,
+	message *telegram.Message,
+) {
+	usage := `Correct usage, to remind the member on duty after 4 hours
+and the whole household after 24 hours:
+
+/set_deadline 4 24
+
+Use 0 to disable a reminder.`
+
+	parts := strings.Fields(message.Text)
+
+	if len(parts) == 1 || len(parts) > 3 {
+		s.client.SendMessage(
+			message.Chat.ID,
+			"⚠️ You didn't provide correct arguments. "+usage,
+		).Execute(ctx)
+		return
+	}
+
+	hours := make([]int, 2)
+	for i, part := range parts[1:] {
+		h, err := strconv.Atoi(part)
+		if err != nil || h < 0 || h > maxDeadlineHours {
+			s.client.SendMessage(
+				message.Chat.ID,
+				fmt.Sprintf("⚠️ Deadlines must be a whole number of hours up to %d. ", maxDeadlineHours)+usage,
+			).Execute(ctx)
+			return
+		}
+
+		hours[i] = h
+	}
+
+	reminder := time.Duration(hours[0]) * time.Hour
+	escalation := time.Duration(hours[1]) * time.Hour
+
+	err := s.uow.ExecuteTransaction(ctx, func(repo storage.HouseholdRepository) error {
+		household, err := repo.FindByID(ctx, message.Chat.ID)
+		if err != nil {
+			return err
+		}
+
+		err = household.SetDeadlines(reminder, escalation)
+		if err != nil {
+			return err
+		}
+
+		err = repo.Save(ctx, household)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+
+	if errors.Is(err, domain.ErrInvalidDeadlines) {
+		s.client.SendMessage(
+			message.Chat.ID,
+			"⚠️ The household must be pinged after the member on duty. "+usage,
+		).Execute(ctx)
+		return
+	}
+
+	if err != nil {
+		s.replyError(ctx, message.Chat.ID, err)
+		return
+	}
+
 	s.client.SendMessage(
 		message.Chat.ID,
-		`/register - become a member of the household
-/set_schedule - change household's schedule
-/set_checklist - change household's checklist
-/skip - skip the current member on duty
-		`,
+		"✅ Your household's deadlines have been updated",
 	).Execute(ctx)
 }
 
+func (s *TelegramService) help(ctx context.Context, message *telegram.Message) {
+	var text strings.Builder
+	for _, c := range Commands {
+		fmt.Fprintf(&text, "/%s - %s\n", c.Command, c.Description)
+	}
+
+	s.client.SendMessage(message.Chat.ID, text.String()).Execute(ctx)
+}
+
+// PublishCommands sets the bot's command menu in group chats
+func (s *TelegramService) PublishCommands(ctx context.Context) error {
+	return s.client.SetMyCommands(Commands).WithScope("all_group_chats").Execute(ctx)
+}
+
 func (s *TelegramService) skip(ctx context.Context, message *telegram.Message) {
-	s.client.SendMessage(message.Chat.ID, "/skip").Execute(ctx)
+	parts := strings.Fields(message.Text)
+	requeue := len(parts) > 1 && parts[1] == "swap"
+
+	var skipped, next *domain.Member
+	err := s.uow.ExecuteTransaction(ctx, func(repo storage.HouseholdRepository) error {
+		household, err := repo.FindByID(ctx, message.Chat.ID)
+		if err != nil {
+			return err
+		}
+
+		skipped, next, err = household.SkipCurrentMember(requeue)
+		if err != nil {
+			return err
+		}
+
+		err = repo.SaveWithMembers(ctx, household)
+		if err != nil {
+			return err
+		}
+
+		// the replacement takes over the checklist and its reminders
+		err = repo.ReassignLatest(ctx, household.TelegramID, next.TelegramID)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+
+	if errors.Is(err, domain.ErrNotEnoughMembers) {
+		s.client.SendMessage(
+			message.Chat.ID,
+			"⚠️ There must be at least two members in the household to skip a turn",
+		).WithReplyParameters(message.MessageID, message.Chat.ID).Execute(ctx)
+		return
+	}
+
+	if errors.Is(err, domain.ErrNobodyOnDuty) {
+		s.client.SendMessage(
+			message.Chat.ID,
+			"⚠️ Nobody is on duty right now, wait for the next notification",
+		).WithReplyParameters(message.MessageID, message.Chat.ID).Execute(ctx)
+		return
+	}
+
+	if err != nil {
+		s.replyError(ctx, message.Chat.ID, err)
+		return
+	}
+
+	text := fmt.Sprintf(
+		"⏭️ %s was skipped, it's %s's turn to clean now",
+		mention(skipped),
+		mention(next),
+	)
+
+	if requeue {
+		text += fmt.Sprintf("\n%s will take the next turn", mention(skipped))
+	}
+
+	s.client.SendMessage(message.Chat.ID, text).WithParseMode("markdown").Execute(ctx)
+}
+
+func (s *TelegramService) leave(ctx context.Context, message *telegram.Message) {
+	removed, err := s.removeMember(ctx, message.Chat.ID, func(h *domain.Household) *domain.Member {
+		return h.FindMember(message.From.ID)
+	})
+
+	if err != nil {
+		s.replyError(ctx, message.Chat.ID, err)
+		return
+	}
+
+	if removed == nil {
+		s.client.SendMessage(
+			message.Chat.ID,
+			"🤷 You are not a member of this household",
+		).WithReplyParameters(message.MessageID, message.Chat.ID).Execute(ctx)
+		return
+	}
+
+	s.client.SendMessage(
+		message.Chat.ID,
+		"👋 You've left the household",
+	).WithReplyParameters(message.MessageID, message.Chat.ID).Execute(ctx)
+}
+
+func (s *TelegramService) remove(ctx context.Context, message *telegram.Message) {
+	isAdmin, err := s.isAdmin(ctx, message.Chat.ID, message.From.ID)
+	if err != nil {
+		s.replyError(ctx, message.Chat.ID, err)
+		return
+	}
+
+	if !isAdmin {
+		s.client.SendMessage(
+			message.Chat.ID,
+			"🛑 Only group admins can remove members",
+		).WithReplyParameters(message.MessageID, message.Chat.ID).Execute(ctx)
+		return
+	}
+
+	var find func(h *domain.Household) *domain.Member
+
+	for _, e := range message.Entities {
+		switch {
+		case e.Type == "text_mention" && e.User != nil:
+			userID := e.User.ID
+			find = func(h *domain.Household) *domain.Member {
+				return h.FindMember(userID)
+			}
+		case e.Type == "mention":
+			username := e.Text(message)
+			find = func(h *domain.Household) *domain.Member {
+				return h.FindMemberByUsername(username)
+			}
+		}
+	}
+
+	if find == nil && message.ReplyToMessage != nil {
+		userID := message.ReplyToMessage.From.ID
+		find = func(h *domain.Household) *domain.Member {
+			return h.FindMember(userID)
+		}
+	}
+
+	if find == nil {
+		s.client.SendMessage(
+			message.Chat.ID,
+			`⚠️ You didn't specify who to remove. Correct usage:
+
+/remove @user`,
+		).Execute(ctx)
+		return
+	}
+
+	removed, err := s.removeMember(ctx, message.Chat.ID, find)
+	if err != nil {
+		s.replyError(ctx, message.Chat.ID, err)
+		return
+	}
+
+	if removed == nil {
+		s.client.SendMessage(
+			message.Chat.ID,
+			"🤷 This user is not a member of the household",
+		).WithReplyParameters(message.MessageID, message.Chat.ID).Execute(ctx)
+		return
+	}
+
+	s.client.SendMessage(
+		message.Chat.ID,
+		fmt.Sprintf("🗑️ %s was removed from the household", mention(removed)),
+	).WithParseMode("markdown").Execute(ctx)
+}
+
+func (s *TelegramService) order(ctx context.Context, message *telegram.Message) {
+	var household *domain.Household
+
+	err := s.uow.Execute(ctx, func(repo storage.HouseholdRepository) error {
+		var err error
+		household, err = repo.FindByID(ctx, message.Chat.ID)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		s.replyError(ctx, message.Chat.ID, err)
+		return
+	}
+
+	if len(household.Members) == 0 {
+		s.client.SendMessage(
+			message.Chat.ID,
+			"🤷 There are no members in the household yet, use /register to join",
+		).Execute(ctx)
+		return
+	}
+
+	s.client.SendMessage(
+		message.Chat.ID,
+		"🔃 Current order of members, 👉 marks the next one on duty:",
+	).WithInlineKeyboardMarkup(orderKeyboard(household)).Execute(ctx)
+}
+
+// removeMember removes the member returned by find from the household.
+// Returns nil if find didn't return anyone
+func (s *TelegramService) removeMember(
+	ctx context.Context,
+	chatID int64,
+	find func(h *domain.Household) *domain.Member,
+) (*domain.Member, error) {
+	var removed *domain.Member
+
+	err := s.uow.ExecuteTransaction(ctx, func(repo storage.HouseholdRepository) error {
+		household, err := repo.FindByID(ctx, chatID)
+		if err != nil {
+			return err
+		}
+
+		m := find(household)
+		if m == nil {
+			return nil
+		}
+
+		removed = household.RemoveMember(m.TelegramID)
+
+		err = repo.SaveWithMembers(ctx, household)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+
+	return removed, err
+}
+
+// replyError tells the user about errors they can fix and logs the rest
+func (s *TelegramService) replyError(ctx context.Context, chatID int64, err error) {
+	if errors.Is(err, storage.ErrHouseholdNotFound) {
+		s.client.SendMessage(
+			chatID,
+			"⚠️ This group isn't a household yet, run /start first",
+		).Execute(ctx)
+		return
+	}
+
+	s.logger.ErrorContext(ctx, "something went wrong", "error", err)
+}
+
+func (s *TelegramService) isAdmin(ctx context.Context, chatID int64, userID int64) (bool, error) {
+	member, err := s.client.GetChatMember(ctx, chatID, userID)
+	if err != nil {
+		return false, err
+	}
+
+	return member.IsAdmin(), nil
 }
 
 func (s *TelegramService) unknownCommand(ctx context.Context, message *telegram.Message) {
 	s.client.SendMessage(message.Chat.ID, "Unknown command").Execute(ctx)
 }
+
+// splitTimeZone separates a TZ= or CRON_TZ= prefix from a crontab
+func splitTimeZone(spec string) (timeZone string, crontab string, ok bool) {
+	for _, prefix := range []string{"CRON_TZ=", "TZ="} {
+		if rest, found := strings.CutPrefix(spec, prefix); found {
+			timeZone, crontab, _ = strings.Cut(rest, " ")
+			return timeZone, strings.TrimSpace(crontab), true
+		}
+	}
+
+	return "", spec, false
+}
+
+func isValidTimeZone(name string) bool {
+	if name == "" || name == "Local" {
+		return false
+	}
+
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
+
+func checklistKeyboard(a *domain.Assignment) telegram.InlineKeyboard {
+	keyboard := telegram.InlineKeyboard{}
+
+	for _, item := range a.Items {
+		text := item.Name
+		if item.IsCompleted() {
+			text = "✅ " + text
+		}
+
+		keyboard = append(keyboard,
+			[]*telegram.InlineKeyboardButton{
+				{
+					Text:         text,
+					CallbackData: fmt.Sprintf("update_checklist:%d:%d", a.ID, item.Position),
+				},
+			},
+		)
+	}
+
+	return keyboard
+}
+
+func orderKeyboard(h *domain.Household) telegram.InlineKeyboard {
+	keyboard := telegram.InlineKeyboard{}
+
+	for i, m := range h.Members {
+		name := m.Name
+		if i == h.CurrentMember {
+			name = "👉 " + name
+		}
+
+		keyboard = append(keyboard,
+			[]*telegram.InlineKeyboardButton{
+				{Text: name, CallbackData: "order_member"},
+				{Text: "⬆️", CallbackData: fmt.Sprintf("order_up:%d", m.TelegramID)},
+				{Text: "⬇️", CallbackData: fmt.Sprintf("order_down:%d", m.TelegramID)},
+			},
+		)
+	}
+
+	return keyboard
+}
+
+// markdownReplacer drops characters that would break a markdown link, they
+// can't be escaped inside one
+var markdownReplacer = strings.NewReplacer("[", "", "]", "", "_", "", "*", "", "`", "")
+
+func mention(m *domain.Member) string {
+	return fmt.Sprintf("[%s](tg://user?id=%d)", markdownReplacer.Replace(m.Name), m.TelegramID)
+}
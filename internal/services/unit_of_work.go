@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"sync"
 
 	"github.com/andrewyazura/duty-reminder/internal/storage"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -55,3 +56,35 @@ func (uow PostgresUnitOfWork) ExecuteTransaction(ctx context.Context, fn func(st
 
 	return nil
 }
+
+// MemoryUnitOfWork runs functions against a storage.MemoryHouseholdRepository
+// one at a time, failed transactions are rolled back to a snapshot
+type MemoryUnitOfWork struct {
+	lock sync.Mutex
+	repo *storage.MemoryHouseholdRepository
+}
+
+func NewMemoryUnitOfWork(repo *storage.MemoryHouseholdRepository) *MemoryUnitOfWork {
+	return &MemoryUnitOfWork{repo: repo}
+}
+
+func (uow *MemoryUnitOfWork) Execute(ctx context.Context, fn func(storage.HouseholdRepository) error) error {
+	uow.lock.Lock()
+	defer uow.lock.Unlock()
+
+	return fn(uow.repo)
+}
+
+func (uow *MemoryUnitOfWork) ExecuteTransaction(ctx context.Context, fn func(storage.HouseholdRepository) error) error {
+	uow.lock.Lock()
+	defer uow.lock.Unlock()
+
+	snapshot := uow.repo.Snapshot()
+
+	if err := fn(uow.repo); err != nil {
+		uow.repo.Restore(snapshot)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/andrewyazura/duty-reminder/internal/domain"
+	"github.com/andrewyazura/duty-reminder/internal/storage"
+)
+
+func TestMemoryUnitOfWork(t *testing.T) {
+	ctx := context.Background()
+	uow := NewMemoryUnitOfWork(storage.NewMemoryHouseholdRepository())
+
+	err := uow.ExecuteTransaction(ctx, func(repo storage.HouseholdRepository) error {
+		return repo.Create(ctx, domain.NewHousehold(-1))
+	})
+	if err != nil {
+		t.Fatalf("ExecuteTransaction() returned an error: %v", err)
+	}
+
+	t.Run("rollback", func(t *testing.T) {
+		want := errors.New("something failed")
+
+		err := uow.ExecuteTransaction(ctx, func(repo storage.HouseholdRepository) error {
+			h, err := repo.FindByID(ctx, -1)
+			if err != nil {
+				return err
+			}
+
+			h.Crontab = "0 8 * * *"
+			if err := repo.Save(ctx, h); err != nil {
+				return err
+			}
+
+			if err := repo.Create(ctx, domain.NewHousehold(-2)); err != nil {
+				return err
+			}
+
+			return want
+		})
+
+		if !errors.Is(err, want) {
+			t.Fatalf("got error %v, want %v", err, want)
+		}
+
+		err = uow.Execute(ctx, func(repo storage.HouseholdRepository) error {
+			h, err := repo.FindByID(ctx, -1)
+			if err != nil {
+				return err
+			}
+
+			if h.Crontab != "0 9 * * 6" {
+				t.Errorf("crontab is %s, want the change to be rolled back", h.Crontab)
+			}
+
+			if _, err := repo.FindByID(ctx, -2); !errors.Is(err, storage.ErrHouseholdNotFound) {
+				t.Errorf("got error %v, want %v", err, storage.ErrHouseholdNotFound)
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			t.Fatalf("Execute() returned an error: %v", err)
+		}
+	})
+
+	t.Run("commit", func(t *testing.T) {
+		err := uow.ExecuteTransaction(ctx, func(repo storage.HouseholdRepository) error {
+			h, err := repo.FindByID(ctx, -1)
+			if err != nil {
+				return err
+			}
+
+			h.Crontab = "0 8 * * *"
+			return repo.Save(ctx, h)
+		})
+
+		if err != nil {
+			t.Fatalf("ExecuteTransaction() returned an error: %v", err)
+		}
+
+		err = uow.Execute(ctx, func(repo storage.HouseholdRepository) error {
+			h, err := repo.FindByID(ctx, -1)
+			if err != nil {
+				return err
+			}
+
+			if h.Crontab != "0 8 * * *" {
+				t.Errorf("crontab is %s, want %s", h.Crontab, "0 8 * * *")
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			t.Fatalf("Execute() returned an error: %v", err)
+		}
+	})
+}
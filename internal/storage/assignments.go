@@ -0,0 +1,252 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/andrewyazura/duty-reminder/internal/domain"
+)
+
+func (repo PostgresHouseholdRepository) CreateAssignment(ctx context.Context, a *domain.Assignment) error {
+	insertAssignmentQuery := `
+		INSERT INTO duty_assignments (
+			household_telegram_id,
+			member_telegram_id,
+			created_at
+		) VALUES ($1, $2, $3)
+		RETURNING id
+	`
+
+	row := repo.db.QueryRow(
+		ctx,
+		insertAssignmentQuery,
+		a.HouseholdID,
+		a.MemberID,
+		a.CreatedAt,
+	)
+
+	if err := row.Scan(&a.ID); err != nil {
+		return err
+	}
+
+	if len(a.Items) == 0 {
+		return nil
+	}
+
+	rows := make([][]any, len(a.Items))
+	for i, item := range a.Items {
+		rows[i] = []any{
+			a.ID,
+			item.Position,
+			item.Name,
+			completedBy(item),
+			item.CompletedAt,
+		}
+	}
+
+	if _, err := repo.db.CopyFrom(
+		ctx,
+		pgx.Identifier{"duty_assignment_items"},
+		[]string{
+			"assignment_id",
+			"position",
+			"name",
+			"completed_by",
+			"completed_at",
+		},
+		pgx.CopyFromRows(rows),
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SaveAssignment records completed items. Items completed in the database
+// already are kept as they are, so a stale copy can't reset them
+func (repo PostgresHouseholdRepository) SaveAssignment(ctx context.Context, a *domain.Assignment) error {
+	updateItemQuery := `
+		UPDATE duty_assignment_items
+		SET completed_by = $1, completed_at = $2
+		WHERE assignment_id = $3 AND position = $4 AND completed_at IS NULL
+	`
+
+	for _, item := range a.Items {
+		if !item.IsCompleted() {
+			continue
+		}
+
+		_, err := repo.db.Exec(
+			ctx,
+			updateItemQuery,
+			completedBy(item),
+			item.CompletedAt,
+			a.ID,
+			item.Position,
+		)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// FindAssignment locks the assignment row until the transaction ends, so
+// concurrent ticks of its checklist run one after another
+func (repo PostgresHouseholdRepository) FindAssignment(ctx context.Context, id int64) (*domain.Assignment, error) {
+	assignmentQuery := `
+		SELECT
+			household_telegram_id,
+			member_telegram_id,
+			created_at
+		FROM duty_assignments
+		WHERE id = $1
+		FOR UPDATE
+	`
+
+	a := &domain.Assignment{ID: id}
+
+	row := repo.db.QueryRow(ctx, assignmentQuery, id)
+	err := row.Scan(&a.HouseholdID, &a.MemberID, &a.CreatedAt)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrAssignmentNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	itemsQuery := `
+		SELECT
+			position,
+			name,
+			completed_by,
+			completed_at
+		FROM duty_assignment_items
+		WHERE assignment_id = $1
+		ORDER BY position ASC
+	`
+
+	rows, err := repo.db.Query(ctx, itemsQuery, id)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	a.Items = []*domain.AssignmentItem{}
+	for rows.Next() {
+		item := &domain.AssignmentItem{}
+		var completedBy *int64
+
+		if err := rows.Scan(&item.Position, &item.Name, &completedBy, &item.CompletedAt); err != nil {
+			return nil, err
+		}
+
+		if completedBy != nil {
+			item.CompletedBy = *completedBy
+		}
+
+		a.Items = append(a.Items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// ReassignLatest hands the household's latest assignment over to the member.
+// Households without assignments are left as they are
+func (repo PostgresHouseholdRepository) ReassignLatest(ctx context.Context, householdID int64, memberID int64) error {
+	reassignQuery := `
+		UPDATE duty_assignments
+		SET member_telegram_id = $2
+		WHERE id = (
+			SELECT max(id)
+			FROM duty_assignments
+			WHERE household_telegram_id = $1
+		)
+	`
+
+	_, err := repo.db.Exec(ctx, reassignQuery, householdID, memberID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// LatestAssignmentIDs returns the id of every household's latest assignment,
+// older assignments have no one on duty to remind anymore
+func (repo PostgresHouseholdRepository) LatestAssignmentIDs(ctx context.Context) ([]int64, error) {
+	latestAssignmentsQuery := `
+		SELECT max(id)
+		FROM duty_assignments
+		GROUP BY household_telegram_id
+		ORDER BY max(id) ASC
+	`
+
+	rows, err := repo.db.Query(ctx, latestAssignmentsQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// ClaimReminder records that the reminder is being sent and reports whether
+// it wasn't claimed before, like ClaimOccurrence does for notifications
+func (repo PostgresHouseholdRepository) ClaimReminder(ctx context.Context, r domain.Reminder) (bool, error) {
+	claimQuery := `
+		INSERT INTO assignment_reminders (
+			assignment_id,
+			escalate
+		) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`
+
+	tag, err := repo.db.Exec(ctx, claimQuery, r.AssignmentID, r.Escalate)
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == foreignKeyViolationCode {
+		return false, ErrAssignmentNotFound
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+func completedBy(item *domain.AssignmentItem) *int64 {
+	if !item.IsCompleted() {
+		return nil
+	}
+
+	return &item.CompletedBy
+}
@@ -0,0 +1,580 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/andrewyazura/duty-reminder/internal/domain"
+)
+
+// testHouseholdRepository checks the behaviour every HouseholdRepository
+// implementation must share, newRepo must return an empty repository
+func testHouseholdRepository(t *testing.T, newRepo func(t *testing.T) HouseholdRepository) {
+	ctx := context.Background()
+
+	t.Run("FindByID not found", func(t *testing.T) {
+		repo := newRepo(t)
+
+		if _, err := repo.FindByID(ctx, -1234567898765); !errors.Is(err, ErrHouseholdNotFound) {
+			t.Fatalf("got error %v, want %v", err, ErrHouseholdNotFound)
+		}
+	})
+
+	t.Run("Create and FindByID", func(t *testing.T) {
+		repo := newRepo(t)
+
+		want := domain.NewHousehold(-1234567898765)
+		want.Checklist = []string{"point 1", "point 2"}
+		want.Crontab = "0 10 * * 1"
+		want.CurrentMember = 0
+		want.TimeZone = "Europe/Kyiv"
+		if err := want.SetDeadlines(4*time.Hour, 24*time.Hour); err != nil {
+			t.Fatalf("SetDeadlines() failed: %v", err)
+		}
+
+		if err := repo.Create(ctx, want); err != nil {
+			t.Fatalf("Create() failed: %v", err)
+		}
+
+		got, err := repo.FindByID(ctx, want.TelegramID)
+		if err != nil {
+			t.Fatalf("FindByID() failed: %v", err)
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got household %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("Create existing", func(t *testing.T) {
+		repo := newRepo(t)
+		h := domain.NewHousehold(-1234567898765)
+
+		if err := repo.Create(ctx, h); err != nil {
+			t.Fatalf("Create() failed: %v", err)
+		}
+
+		if err := repo.Create(ctx, h); !errors.Is(err, ErrHouseholdExists) {
+			t.Fatalf("got error %v, want %v", err, ErrHouseholdExists)
+		}
+	})
+
+	t.Run("SaveWithMembers and Save", func(t *testing.T) {
+		repo := newRepo(t)
+		h := domain.NewHousehold(-1234567898765)
+
+		if err := repo.Create(ctx, h); err != nil {
+			t.Fatalf("Create() failed: %v", err)
+		}
+
+		h.AddMember(&domain.Member{Name: "test1", Username: "one", TelegramID: 1})
+		h.AddMember(&domain.Member{Name: "test2", TelegramID: 2})
+		h.AddMember(&domain.Member{Name: "test3", TelegramID: 3})
+		h.MoveMember(3, -2)
+		h.PopCurrentMember()
+
+		if err := repo.SaveWithMembers(ctx, h); err != nil {
+			t.Fatalf("SaveWithMembers() failed: %v", err)
+		}
+
+		// Save must not touch members
+		h.Crontab = "0 8 * * *"
+		h.RemoveMember(2)
+
+		notifiedAt := time.Date(2025, time.January, 4, 9, 0, 0, 0, time.UTC)
+		h.LastNotifiedAt = &notifiedAt
+
+		if err := repo.Save(ctx, h); err != nil {
+			t.Fatalf("Save() failed: %v", err)
+		}
+
+		got, err := repo.FindByID(ctx, h.TelegramID)
+		if err != nil {
+			t.Fatalf("FindByID() failed: %v", err)
+		}
+
+		if got.Crontab != h.Crontab || got.CurrentMember != h.CurrentMember {
+			t.Errorf("got crontab %s and current member %d, want %s and %d", got.Crontab, got.CurrentMember, h.Crontab, h.CurrentMember)
+		}
+
+		if got.LastNotifiedAt == nil || !got.LastNotifiedAt.Equal(notifiedAt) {
+			t.Errorf("got last notified at %v, want %s", got.LastNotifiedAt, notifiedAt)
+		}
+
+		if got.OnDutyID != 1 {
+			t.Errorf("got member on duty %d, want %d", got.OnDutyID, 1)
+		}
+
+		want := []domain.Member{
+			{Name: "test3", TelegramID: 3, Order: 0},
+			{Name: "test1", Username: "one", TelegramID: 1, Order: 1},
+			{Name: "test2", TelegramID: 2, Order: 2},
+		}
+
+		if len(got.Members) != len(want) {
+			t.Fatalf("got %d members, want %d", len(got.Members), len(want))
+		}
+
+		for i, m := range got.Members {
+			if *m != want[i] {
+				t.Errorf("got member %v, want %v", *m, want[i])
+			}
+		}
+	})
+
+	t.Run("GetSchedules", func(t *testing.T) {
+		repo := newRepo(t)
+
+		h1 := domain.NewHousehold(-1)
+		h2 := domain.NewHousehold(-2)
+		h2.Crontab = "0 10 * * *"
+		h2.TimeZone = "Asia/Tokyo"
+
+		notifiedAt := time.Date(2025, time.January, 4, 10, 0, 0, 0, time.UTC)
+		h2.LastNotifiedAt = &notifiedAt
+
+		for _, h := range []*domain.Household{h1, h2} {
+			if err := repo.Create(ctx, h); err != nil {
+				t.Fatalf("Create() failed: %v", err)
+			}
+		}
+
+		got, err := repo.GetSchedules(ctx)
+		if err != nil {
+			t.Fatalf("GetSchedules() failed: %v", err)
+		}
+
+		if len(got) != 2 {
+			t.Fatalf("got %d households, want %d", len(got), 2)
+		}
+
+		slices.SortFunc(got, func(a, b *domain.Household) int {
+			return int(b.TelegramID - a.TelegramID)
+		})
+
+		for i, want := range []*domain.Household{h1, h2} {
+			if got[i].TelegramID != want.TelegramID || got[i].Crontab != want.Crontab || got[i].TimeZone != want.TimeZone {
+				t.Errorf("got schedule %+v, want %+v", got[i], want)
+			}
+		}
+
+		if got[0].LastNotifiedAt != nil {
+			t.Errorf("got last notified at %s, want nil", got[0].LastNotifiedAt)
+		}
+
+		if got[1].LastNotifiedAt == nil || !got[1].LastNotifiedAt.Equal(notifiedAt) {
+			t.Errorf("got last notified at %v, want %s", got[1].LastNotifiedAt, notifiedAt)
+		}
+	})
+
+	t.Run("ClaimOccurrence", func(t *testing.T) {
+		repo := newRepo(t)
+
+		h := domain.NewHousehold(-1234567898765)
+		if err := repo.Create(ctx, h); err != nil {
+			t.Fatalf("Create() failed: %v", err)
+		}
+
+		saturday := time.Date(2025, time.January, 4, 9, 0, 0, 0, time.UTC)
+		tests := []struct {
+			name       string
+			occurrence domain.Occurrence
+			want       bool
+		}{
+			{"first claim", domain.Occurrence{HouseholdID: h.TelegramID, ScheduledAt: saturday}, true},
+			{"same occurrence", domain.Occurrence{HouseholdID: h.TelegramID, ScheduledAt: saturday}, false},
+			{"next occurrence", domain.Occurrence{HouseholdID: h.TelegramID, ScheduledAt: saturday.AddDate(0, 0, 7)}, true},
+			{"prunes old claims", domain.Occurrence{HouseholdID: h.TelegramID, ScheduledAt: saturday.AddDate(0, 2, 0)}, true},
+			{"pruned occurrence", domain.Occurrence{HouseholdID: h.TelegramID, ScheduledAt: saturday}, true},
+			{"kept occurrence", domain.Occurrence{HouseholdID: h.TelegramID, ScheduledAt: saturday.AddDate(0, 2, 0)}, false},
+		}
+
+		for _, tt := range tests {
+			got, err := repo.ClaimOccurrence(ctx, tt.occurrence)
+			if err != nil {
+				t.Fatalf("%s: ClaimOccurrence() failed: %v", tt.name, err)
+			}
+
+			if got != tt.want {
+				t.Errorf("%s: got claimed %t, want %t", tt.name, got, tt.want)
+			}
+		}
+
+		_, err := repo.ClaimOccurrence(ctx, domain.Occurrence{HouseholdID: -1, ScheduledAt: saturday})
+		if !errors.Is(err, ErrHouseholdNotFound) {
+			t.Errorf("got error %v, want %v", err, ErrHouseholdNotFound)
+		}
+	})
+
+	t.Run("Outbox", func(t *testing.T) {
+		repo := newRepo(t)
+
+		h1 := domain.NewHousehold(-1)
+		h2 := domain.NewHousehold(-2)
+		createdAt := time.Date(2025, time.March, 1, 9, 0, 0, 0, time.UTC)
+
+		for _, e := range []struct {
+			eventType string
+			household *domain.Household
+		}{
+			{"HouseholdCreated", h1},
+			{"HouseholdCreated", h2},
+			{"HouseholdCrontabUpdated", h1},
+		} {
+			if err := repo.AddToOutbox(ctx, e.eventType, e.household, createdAt); err != nil {
+				t.Fatalf("AddToOutbox() failed: %v", err)
+			}
+		}
+
+		claimed, err := repo.ClaimOutbox(ctx, 2, createdAt)
+		if err != nil {
+			t.Fatalf("ClaimOutbox() failed: %v", err)
+		}
+
+		if len(claimed) != 2 {
+			t.Fatalf("claimed %d events, want 2", len(claimed))
+		}
+
+		if claimed[0].Type != "HouseholdCreated" || claimed[0].HouseholdID != h1.TelegramID || claimed[0].Attempts != 1 {
+			t.Errorf("got first event %+v, want the first attempt of HouseholdCreated of %d", claimed[0], h1.TelegramID)
+		}
+
+		if !claimed[0].CreatedAt.Equal(createdAt) {
+			t.Errorf("got event created at %s, want %s", claimed[0].CreatedAt, createdAt)
+		}
+
+		// claimed events are skipped until their claim expires
+		rest, err := repo.ClaimOutbox(ctx, 10, createdAt)
+		if err != nil {
+			t.Fatalf("ClaimOutbox() failed: %v", err)
+		}
+
+		if len(rest) != 1 || rest[0].Type != "HouseholdCrontabUpdated" || rest[0].HouseholdID != h1.TelegramID {
+			t.Errorf("got claimed events %+v, want only HouseholdCrontabUpdated of %d", rest, h1.TelegramID)
+		}
+
+		if err := repo.MarkDispatched(ctx, []int64{claimed[0].ID, claimed[1].ID}, createdAt); err != nil {
+			t.Fatalf("MarkDispatched() failed: %v", err)
+		}
+
+		retried, err := repo.ClaimOutbox(ctx, 10, createdAt.Add(time.Hour))
+		if err != nil {
+			t.Fatalf("ClaimOutbox() failed: %v", err)
+		}
+
+		if len(retried) != 1 || retried[0].ID != rest[0].ID || retried[0].Attempts != 2 {
+			t.Errorf("got claimed events %+v, want the second attempt of event %d", retried, rest[0].ID)
+		}
+
+		// prunes the events dispatched first, new events still get new ids
+		last := retried[0].ID
+		if err := repo.MarkDispatched(ctx, []int64{last}, createdAt.AddDate(0, 1, 0)); err != nil {
+			t.Fatalf("MarkDispatched() failed: %v", err)
+		}
+
+		if err := repo.AddToOutbox(ctx, "HouseholdCreated", h2, createdAt.AddDate(0, 1, 0)); err != nil {
+			t.Fatalf("AddToOutbox() failed: %v", err)
+		}
+
+		claimed, err = repo.ClaimOutbox(ctx, 10, createdAt.AddDate(0, 1, 0))
+		if err != nil {
+			t.Fatalf("ClaimOutbox() failed: %v", err)
+		}
+
+		if len(claimed) != 1 || claimed[0].ID <= last {
+			t.Errorf("got claimed events %+v, want a new event with an id after %d", claimed, last)
+		}
+	})
+
+	t.Run("Outbox gives up", func(t *testing.T) {
+		repo := newRepo(t)
+
+		createdAt := time.Date(2025, time.March, 1, 9, 0, 0, 0, time.UTC)
+		if err := repo.AddToOutbox(ctx, "HouseholdCreated", domain.NewHousehold(-1), createdAt); err != nil {
+			t.Fatalf("AddToOutbox() failed: %v", err)
+		}
+
+		at := createdAt
+		for attempt := 1; attempt <= outboxMaxAttempts; attempt++ {
+			claimed, err := repo.ClaimOutbox(ctx, 10, at)
+			if err != nil {
+				t.Fatalf("ClaimOutbox() failed: %v", err)
+			}
+
+			if len(claimed) != 1 || claimed[0].Attempts != attempt {
+				t.Fatalf("got claimed events %+v, want attempt %d", claimed, attempt)
+			}
+
+			at = at.Add(outboxLease)
+		}
+
+		claimed, err := repo.ClaimOutbox(ctx, 10, at)
+		if err != nil {
+			t.Fatalf("ClaimOutbox() failed: %v", err)
+		}
+
+		if len(claimed) != 0 {
+			t.Errorf("got claimed events %+v, want none after %d attempts", claimed, outboxMaxAttempts)
+		}
+	})
+
+	t.Run("DeadLetters", func(t *testing.T) {
+		repo := newRepo(t)
+
+		failedAt := time.Date(2025, time.March, 1, 9, 0, 0, 0, time.UTC)
+		for _, subscriber := range []string{"first", "second"} {
+			dl := &DeadLetter{
+				EventType:  "NotifyHousehold",
+				Subscriber: subscriber,
+				Payload:    []byte(`{"HouseholdID": -1}`),
+				Error:      "handler failed",
+				Attempts:   5,
+				FailedAt:   failedAt,
+			}
+
+			if err := repo.AddDeadLetter(ctx, dl); err != nil {
+				t.Fatalf("AddDeadLetter() failed: %v", err)
+			}
+
+			if dl.ID == 0 {
+				t.Fatalf("AddDeadLetter() didn't set the id")
+			}
+		}
+
+		pending, err := repo.PendingDeadLetters(ctx, 10)
+		if err != nil {
+			t.Fatalf("PendingDeadLetters() failed: %v", err)
+		}
+
+		if len(pending) != 2 || pending[0].Subscriber != "first" {
+			t.Fatalf("got pending dead letters %+v, want first and second", pending)
+		}
+
+		got, err := repo.FindDeadLetter(ctx, pending[0].ID)
+		if err != nil {
+			t.Fatalf("FindDeadLetter() failed: %v", err)
+		}
+
+		var payload struct{ HouseholdID int64 }
+		if err := json.Unmarshal(got.Payload, &payload); err != nil || payload.HouseholdID != -1 {
+			t.Errorf("got payload %s, want HouseholdID -1", got.Payload)
+		}
+
+		if got.EventType != "NotifyHousehold" || got.Error != "handler failed" || got.Attempts != 5 || !got.FailedAt.Equal(failedAt) {
+			t.Errorf("got dead letter %+v", got)
+		}
+
+		if err := repo.MarkReplayed(ctx, got.ID, time.Now()); err != nil {
+			t.Fatalf("MarkReplayed() failed: %v", err)
+		}
+
+		if _, err := repo.FindDeadLetter(ctx, got.ID); !errors.Is(err, ErrDeadLetterNotFound) {
+			t.Errorf("got error %v, want %v", err, ErrDeadLetterNotFound)
+		}
+
+		pending, err = repo.PendingDeadLetters(ctx, 10)
+		if err != nil {
+			t.Fatalf("PendingDeadLetters() failed: %v", err)
+		}
+
+		if len(pending) != 1 || pending[0].Subscriber != "second" {
+			t.Errorf("got pending dead letters %+v, want only second", pending)
+		}
+
+		// prunes the dead letters replayed first, new ones still get new ids
+		last := pending[0].ID
+		if err := repo.MarkReplayed(ctx, last, time.Now().AddDate(0, 2, 0)); err != nil {
+			t.Fatalf("MarkReplayed() failed: %v", err)
+		}
+
+		dl := &DeadLetter{
+			EventType:  "NotifyHousehold",
+			Subscriber: "third",
+			Payload:    []byte(`{"HouseholdID": -1}`),
+			Error:      "handler failed",
+			Attempts:   5,
+			FailedAt:   failedAt,
+		}
+
+		if err := repo.AddDeadLetter(ctx, dl); err != nil {
+			t.Fatalf("AddDeadLetter() failed: %v", err)
+		}
+
+		if dl.ID <= last {
+			t.Errorf("got dead letter id %d, want an id after %d", dl.ID, last)
+		}
+
+		pending, err = repo.PendingDeadLetters(ctx, 10)
+		if err != nil {
+			t.Fatalf("PendingDeadLetters() failed: %v", err)
+		}
+
+		if len(pending) != 1 || pending[0].ID != dl.ID {
+			t.Errorf("got pending dead letters %+v, want only third", pending)
+		}
+	})
+
+	t.Run("Assignments", func(t *testing.T) {
+		repo := newRepo(t)
+
+		h := domain.NewHousehold(-1234567898765)
+		h.Checklist = []string{"point 1", "point 2"}
+		h.AddMember(&domain.Member{Name: "test1", TelegramID: 1})
+
+		if err := repo.Create(ctx, h); err != nil {
+			t.Fatalf("Create() failed: %v", err)
+		}
+
+		now := time.Date(2025, 1, 4, 9, 0, 0, 0, time.UTC)
+		first := domain.NewAssignment(h, h.Members[0], now)
+		second := domain.NewAssignment(h, h.Members[0], now.Add(time.Hour))
+
+		for _, a := range []*domain.Assignment{first, second} {
+			if err := repo.CreateAssignment(ctx, a); err != nil {
+				t.Fatalf("CreateAssignment() failed: %v", err)
+			}
+		}
+
+		if first.ID == 0 || first.ID == second.ID {
+			t.Fatalf("got assignment ids %d and %d, want unique ids", first.ID, second.ID)
+		}
+
+		if err := first.CompleteItem(1, 1, now); err != nil {
+			t.Fatalf("CompleteItem() failed: %v", err)
+		}
+
+		if err := repo.SaveAssignment(ctx, first); err != nil {
+			t.Fatalf("SaveAssignment() failed: %v", err)
+		}
+
+		got, err := repo.FindAssignment(ctx, first.ID)
+		if err != nil {
+			t.Fatalf("FindAssignment() failed: %v", err)
+		}
+
+		if got.HouseholdID != first.HouseholdID || got.MemberID != first.MemberID || !got.CreatedAt.Equal(now) {
+			t.Errorf("got assignment %+v, want %+v", got, first)
+		}
+
+		if len(got.Items) != 2 {
+			t.Fatalf("got %d items, want %d", len(got.Items), 2)
+		}
+
+		if got.Items[0].IsCompleted() {
+			t.Errorf("item %s is completed, want not completed", got.Items[0].Name)
+		}
+
+		if item := got.Items[1]; item.CompletedBy != 1 || !item.CompletedAt.Equal(now) {
+			t.Errorf("item completed by %d at %v, want %d at %v", item.CompletedBy, item.CompletedAt, 1, now)
+		}
+
+		if _, err := repo.FindAssignment(ctx, second.ID+1); !errors.Is(err, ErrAssignmentNotFound) {
+			t.Errorf("got error %v, want %v", err, ErrAssignmentNotFound)
+		}
+
+		latest, err := repo.LatestAssignmentIDs(ctx)
+		if err != nil {
+			t.Fatalf("LatestAssignmentIDs() failed: %v", err)
+		}
+
+		if !slices.Equal(latest, []int64{second.ID}) {
+			t.Errorf("got latest assignments %v, want [%d]", latest, second.ID)
+		}
+
+		// ticks of different items loaded at the same time keep each other
+		var copies []*domain.Assignment
+		for range 2 {
+			c, err := repo.FindAssignment(ctx, second.ID)
+			if err != nil {
+				t.Fatalf("FindAssignment() failed: %v", err)
+			}
+
+			copies = append(copies, c)
+		}
+
+		for position, c := range copies {
+			if err := c.CompleteItem(position, 1, now); err != nil {
+				t.Fatalf("CompleteItem() failed: %v", err)
+			}
+
+			if err := repo.SaveAssignment(ctx, c); err != nil {
+				t.Fatalf("SaveAssignment() failed: %v", err)
+			}
+		}
+
+		got, err = repo.FindAssignment(ctx, second.ID)
+		if err != nil {
+			t.Fatalf("FindAssignment() failed: %v", err)
+		}
+
+		if !got.IsCompleted() {
+			t.Errorf("got items %+v %+v, want both completed", got.Items[0], got.Items[1])
+		}
+
+		if err := repo.ReassignLatest(ctx, h.TelegramID, 2); err != nil {
+			t.Fatalf("ReassignLatest() failed: %v", err)
+		}
+
+		for _, want := range []struct {
+			id       int64
+			memberID int64
+		}{{first.ID, 1}, {second.ID, 2}} {
+			got, err := repo.FindAssignment(ctx, want.id)
+			if err != nil {
+				t.Fatalf("FindAssignment() failed: %v", err)
+			}
+
+			if got.MemberID != want.memberID {
+				t.Errorf("assignment %d belongs to %d, want %d", want.id, got.MemberID, want.memberID)
+			}
+		}
+	})
+
+	t.Run("ClaimReminder", func(t *testing.T) {
+		repo := newRepo(t)
+
+		h := domain.NewHousehold(-1)
+		h.Checklist = []string{"dishes"}
+		h.AddMember(&domain.Member{Name: "test1", TelegramID: 1})
+
+		if err := repo.Create(ctx, h); err != nil {
+			t.Fatalf("Create() failed: %v", err)
+		}
+
+		a := domain.NewAssignment(h, h.Members[0], time.Now())
+		if err := repo.CreateAssignment(ctx, a); err != nil {
+			t.Fatalf("CreateAssignment() failed: %v", err)
+		}
+
+		reminder := domain.Reminder{AssignmentID: a.ID, HouseholdID: h.TelegramID}
+		escalation := domain.Reminder{AssignmentID: a.ID, HouseholdID: h.TelegramID, Escalate: true}
+
+		for _, tt := range []struct {
+			reminder domain.Reminder
+			want     bool
+		}{
+			{reminder, true},
+			{reminder, false},
+			{escalation, true},
+		} {
+			claimed, err := repo.ClaimReminder(ctx, tt.reminder)
+			if err != nil {
+				t.Fatalf("ClaimReminder() failed: %v", err)
+			}
+
+			if claimed != tt.want {
+				t.Errorf("ClaimReminder(%+v) = %v, want %v", tt.reminder, claimed, tt.want)
+			}
+		}
+
+		_, err := repo.ClaimReminder(ctx, domain.Reminder{AssignmentID: a.ID + 1})
+		if !errors.Is(err, ErrAssignmentNotFound) {
+			t.Errorf("got error %v, want %v", err, ErrAssignmentNotFound)
+		}
+	})
+}
@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// deadLetterRetention is how long replayed dead letters are kept before they're pruned
+const deadLetterRetention = 30 * 24 * time.Hour
+
+// DeadLetter is an event whose handler kept failing, it is kept until it is
+// replayed by an admin
+type DeadLetter struct {
+	ID         int64
+	EventType  string
+	Subscriber string
+	Payload    []byte
+	Error      string
+	Attempts   int
+	FailedAt   time.Time
+}
+
+func (repo PostgresHouseholdRepository) AddDeadLetter(ctx context.Context, dl *DeadLetter) error {
+	insertDeadLetterQuery := `
+		INSERT INTO dead_letters (
+			event_type,
+			subscriber,
+			payload,
+			error,
+			attempts,
+			failed_at
+		) VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`
+
+	err := repo.db.QueryRow(
+		ctx,
+		insertDeadLetterQuery,
+		dl.EventType,
+		dl.Subscriber,
+		string(dl.Payload),
+		dl.Error,
+		dl.Attempts,
+		dl.FailedAt,
+	).Scan(&dl.ID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// PendingDeadLetters returns the oldest dead letters that weren't replayed
+func (repo PostgresHouseholdRepository) PendingDeadLetters(ctx context.Context, limit int) ([]DeadLetter, error) {
+	pendingDeadLettersQuery := `
+		SELECT
+			id,
+			event_type,
+			subscriber,
+			payload,
+			error,
+			attempts,
+			failed_at
+		FROM dead_letters
+		WHERE replayed_at IS NULL
+		ORDER BY id ASC
+		LIMIT $1
+	`
+
+	rows, err := repo.db.Query(ctx, pendingDeadLettersQuery, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var letters []DeadLetter
+	for rows.Next() {
+		dl, err := scanDeadLetter(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		letters = append(letters, *dl)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return letters, nil
+}
+
+func (repo PostgresHouseholdRepository) FindDeadLetter(ctx context.Context, id int64) (*DeadLetter, error) {
+	deadLetterQuery := `
+		SELECT
+			id,
+			event_type,
+			subscriber,
+			payload,
+			error,
+			attempts,
+			failed_at
+		FROM dead_letters
+		WHERE id = $1 AND replayed_at IS NULL
+	`
+
+	dl, err := scanDeadLetter(repo.db.QueryRow(ctx, deadLetterQuery, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrDeadLetterNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return dl, nil
+}
+
+// MarkReplayed marks the dead letter as replayed at the time and prunes
+// dead letters replayed more than deadLetterRetention before it
+func (repo PostgresHouseholdRepository) MarkReplayed(ctx context.Context, id int64, at time.Time) error {
+	markReplayedQuery := `
+		UPDATE dead_letters
+		SET replayed_at = $1
+		WHERE id = $2
+	`
+
+	_, err := repo.db.Exec(ctx, markReplayedQuery, at, id)
+	if err != nil {
+		return err
+	}
+
+	pruneQuery := `
+		DELETE FROM dead_letters
+		WHERE replayed_at < $1
+	`
+
+	_, err = repo.db.Exec(ctx, pruneQuery, at.Add(-deadLetterRetention))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func scanDeadLetter(row pgx.Row) (*DeadLetter, error) {
+	var dl DeadLetter
+	var payload string
+
+	err := row.Scan(
+		&dl.ID,
+		&dl.EventType,
+		&dl.Subscriber,
+		&payload,
+		&dl.Error,
+		&dl.Attempts,
+		&dl.FailedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	dl.Payload = []byte(payload)
+	return &dl, nil
+}
@@ -0,0 +1,432 @@
+package storage
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/andrewyazura/duty-reminder/internal/domain"
+)
+
+// MemoryHouseholdRepository keeps households in memory, it mirrors
+// PostgresHouseholdRepository and is meant for tests.
+// It isn't safe for concurrent use, services.MemoryUnitOfWork guards it
+type MemoryHouseholdRepository struct {
+	households       map[int64]*domain.Household
+	assignments      map[int64]*domain.Assignment
+	lastAssignmentID int64
+	occurrences      map[occurrenceKey]bool
+	reminders        map[domain.Reminder]bool
+	outbox           []*outboxEntry
+	lastOutboxID     int64
+	deadLetters      []*deadLetterEntry
+	lastDeadLetterID int64
+}
+
+type outboxEntry struct {
+	event        OutboxEvent
+	claimedUntil *time.Time
+	dispatchedAt *time.Time
+}
+
+type deadLetterEntry struct {
+	letter     DeadLetter
+	replayedAt *time.Time
+}
+
+type occurrenceKey struct {
+	householdID int64
+	scheduledAt int64
+}
+
+func NewMemoryHouseholdRepository() *MemoryHouseholdRepository {
+	return &MemoryHouseholdRepository{
+		households:  make(map[int64]*domain.Household),
+		assignments: make(map[int64]*domain.Assignment),
+		occurrences: make(map[occurrenceKey]bool),
+		reminders:   make(map[domain.Reminder]bool),
+	}
+}
+
+// Snapshot returns a deep copy of the repository's state
+func (repo *MemoryHouseholdRepository) Snapshot() *MemoryHouseholdRepository {
+	snapshot := NewMemoryHouseholdRepository()
+	snapshot.lastAssignmentID = repo.lastAssignmentID
+	snapshot.lastOutboxID = repo.lastOutboxID
+	snapshot.lastDeadLetterID = repo.lastDeadLetterID
+
+	for id, h := range repo.households {
+		snapshot.households[id] = cloneHousehold(h)
+	}
+
+	for id, a := range repo.assignments {
+		snapshot.assignments[id] = cloneAssignment(a)
+	}
+
+	for key := range repo.occurrences {
+		snapshot.occurrences[key] = true
+	}
+
+	for key := range repo.reminders {
+		snapshot.reminders[key] = true
+	}
+
+	for _, entry := range repo.outbox {
+		snapshot.outbox = append(snapshot.outbox, &outboxEntry{
+			event:        entry.event,
+			claimedUntil: cloneTime(entry.claimedUntil),
+			dispatchedAt: cloneTime(entry.dispatchedAt),
+		})
+	}
+
+	for _, entry := range repo.deadLetters {
+		snapshot.deadLetters = append(snapshot.deadLetters, &deadLetterEntry{
+			letter:     cloneDeadLetter(entry.letter),
+			replayedAt: cloneTime(entry.replayedAt),
+		})
+	}
+
+	return snapshot
+}
+
+// Restore replaces the repository's state with a snapshot
+func (repo *MemoryHouseholdRepository) Restore(snapshot *MemoryHouseholdRepository) {
+	repo.households = snapshot.households
+	repo.assignments = snapshot.assignments
+	repo.lastAssignmentID = snapshot.lastAssignmentID
+	repo.lastOutboxID = snapshot.lastOutboxID
+	repo.occurrences = snapshot.occurrences
+	repo.reminders = snapshot.reminders
+	repo.outbox = snapshot.outbox
+	repo.deadLetters = snapshot.deadLetters
+	repo.lastDeadLetterID = snapshot.lastDeadLetterID
+}
+
+func (repo *MemoryHouseholdRepository) Create(ctx context.Context, h *domain.Household) error {
+	if _, ok := repo.households[h.TelegramID]; ok {
+		return ErrHouseholdExists
+	}
+
+	stored := cloneHousehold(h)
+	stored.Members = []*domain.Member{}
+	repo.households[h.TelegramID] = stored
+
+	return nil
+}
+
+func (repo *MemoryHouseholdRepository) Save(ctx context.Context, h *domain.Household) error {
+	stored, ok := repo.households[h.TelegramID]
+	if !ok {
+		return nil
+	}
+
+	updated := cloneHousehold(h)
+	updated.Members = stored.Members
+	repo.households[h.TelegramID] = updated
+
+	return nil
+}
+
+func (repo *MemoryHouseholdRepository) SaveWithMembers(ctx context.Context, h *domain.Household) error {
+	if _, ok := repo.households[h.TelegramID]; !ok {
+		return nil
+	}
+
+	repo.households[h.TelegramID] = cloneHousehold(h)
+
+	return nil
+}
+
+func (repo *MemoryHouseholdRepository) FindByID(ctx context.Context, telegramID int64) (*domain.Household, error) {
+	stored, ok := repo.households[telegramID]
+	if !ok {
+		return nil, ErrHouseholdNotFound
+	}
+
+	h := cloneHousehold(stored)
+	slices.SortStableFunc(h.Members, func(a, b *domain.Member) int {
+		return a.Order - b.Order
+	})
+
+	return h, nil
+}
+
+func (repo *MemoryHouseholdRepository) GetSchedules(ctx context.Context) ([]*domain.Household, error) {
+	var households []*domain.Household
+
+	for _, stored := range repo.households {
+		households = append(households, &domain.Household{
+			TelegramID:     stored.TelegramID,
+			Checklist:      slices.Clone(stored.Checklist),
+			Crontab:        stored.Crontab,
+			TimeZone:       stored.TimeZone,
+			LastNotifiedAt: cloneTime(stored.LastNotifiedAt),
+		})
+	}
+
+	return households, nil
+}
+
+func (repo *MemoryHouseholdRepository) CreateAssignment(ctx context.Context, a *domain.Assignment) error {
+	repo.lastAssignmentID++
+	a.ID = repo.lastAssignmentID
+
+	repo.assignments[a.ID] = cloneAssignment(a)
+
+	return nil
+}
+
+func (repo *MemoryHouseholdRepository) SaveAssignment(ctx context.Context, a *domain.Assignment) error {
+	stored, ok := repo.assignments[a.ID]
+	if !ok {
+		return nil
+	}
+
+	for _, item := range a.Items {
+		if item.Position < 0 || item.Position >= len(stored.Items) {
+			continue
+		}
+
+		if !item.IsCompleted() || stored.Items[item.Position].IsCompleted() {
+			continue
+		}
+
+		completed := cloneAssignmentItem(item)
+		stored.Items[item.Position].CompletedBy = completed.CompletedBy
+		stored.Items[item.Position].CompletedAt = completed.CompletedAt
+	}
+
+	return nil
+}
+
+func (repo *MemoryHouseholdRepository) FindAssignment(ctx context.Context, id int64) (*domain.Assignment, error) {
+	stored, ok := repo.assignments[id]
+	if !ok {
+		return nil, ErrAssignmentNotFound
+	}
+
+	return cloneAssignment(stored), nil
+}
+
+func (repo *MemoryHouseholdRepository) ReassignLatest(ctx context.Context, householdID int64, memberID int64) error {
+	var latest *domain.Assignment
+	for _, a := range repo.assignments {
+		if a.HouseholdID == householdID && (latest == nil || a.ID > latest.ID) {
+			latest = a
+		}
+	}
+
+	if latest != nil {
+		latest.MemberID = memberID
+	}
+
+	return nil
+}
+
+func (repo *MemoryHouseholdRepository) LatestAssignmentIDs(ctx context.Context) ([]int64, error) {
+	latest := make(map[int64]int64)
+	for id, a := range repo.assignments {
+		latest[a.HouseholdID] = max(latest[a.HouseholdID], id)
+	}
+
+	ids := slices.Collect(maps.Values(latest))
+	slices.Sort(ids)
+
+	return ids, nil
+}
+
+func (repo *MemoryHouseholdRepository) ClaimReminder(ctx context.Context, r domain.Reminder) (bool, error) {
+	if _, ok := repo.assignments[r.AssignmentID]; !ok {
+		return false, ErrAssignmentNotFound
+	}
+
+	// only the fields the postgres key is made of
+	key := domain.Reminder{AssignmentID: r.AssignmentID, Escalate: r.Escalate}
+	if repo.reminders[key] {
+		return false, nil
+	}
+
+	repo.reminders[key] = true
+	return true, nil
+}
+
+func (repo *MemoryHouseholdRepository) ClaimOccurrence(ctx context.Context, o domain.Occurrence) (bool, error) {
+	if _, ok := repo.households[o.HouseholdID]; !ok {
+		return false, ErrHouseholdNotFound
+	}
+
+	key := occurrenceKey{householdID: o.HouseholdID, scheduledAt: o.ScheduledAt.UnixNano()}
+	if repo.occurrences[key] {
+		return false, nil
+	}
+
+	repo.occurrences[key] = true
+
+	since := o.ScheduledAt.Add(-occurrenceRetention).UnixNano()
+	maps.DeleteFunc(repo.occurrences, func(k occurrenceKey, _ bool) bool {
+		return k.householdID == o.HouseholdID && k.scheduledAt < since
+	})
+
+	return true, nil
+}
+
+func (repo *MemoryHouseholdRepository) AddToOutbox(
+	ctx context.Context,
+	eventType string,
+	h *domain.Household,
+	at time.Time,
+) error {
+	repo.lastOutboxID++
+	repo.outbox = append(repo.outbox, &outboxEntry{
+		event: OutboxEvent{
+			ID:          repo.lastOutboxID,
+			Type:        eventType,
+			HouseholdID: h.TelegramID,
+			CreatedAt:   at,
+		},
+	})
+
+	return nil
+}
+
+func (repo *MemoryHouseholdRepository) ClaimOutbox(ctx context.Context, limit int, at time.Time) ([]OutboxEvent, error) {
+	var events []OutboxEvent
+
+	for _, entry := range repo.outbox {
+		if len(events) == limit {
+			break
+		}
+
+		if entry.dispatchedAt != nil || entry.event.Attempts >= outboxMaxAttempts {
+			continue
+		}
+
+		if entry.claimedUntil != nil && entry.claimedUntil.After(at) {
+			continue
+		}
+
+		claimedUntil := at.Add(outboxLease)
+		entry.claimedUntil = &claimedUntil
+		entry.event.Attempts++
+
+		events = append(events, entry.event)
+	}
+
+	return events, nil
+}
+
+func (repo *MemoryHouseholdRepository) MarkDispatched(ctx context.Context, ids []int64, at time.Time) error {
+	for _, entry := range repo.outbox {
+		if slices.Contains(ids, entry.event.ID) {
+			entry.dispatchedAt = &at
+		}
+	}
+
+	before := at.Add(-outboxRetention)
+	repo.outbox = slices.DeleteFunc(repo.outbox, func(entry *outboxEntry) bool {
+		if entry.dispatchedAt == nil {
+			return entry.event.Attempts >= outboxMaxAttempts && entry.event.CreatedAt.Before(before)
+		}
+
+		return entry.dispatchedAt.Before(before)
+	})
+
+	return nil
+}
+
+func (repo *MemoryHouseholdRepository) AddDeadLetter(ctx context.Context, dl *DeadLetter) error {
+	repo.lastDeadLetterID++
+	dl.ID = repo.lastDeadLetterID
+	repo.deadLetters = append(repo.deadLetters, &deadLetterEntry{letter: cloneDeadLetter(*dl)})
+
+	return nil
+}
+
+func (repo *MemoryHouseholdRepository) PendingDeadLetters(ctx context.Context, limit int) ([]DeadLetter, error) {
+	var letters []DeadLetter
+
+	for _, entry := range repo.deadLetters {
+		if len(letters) == limit {
+			break
+		}
+
+		if entry.replayedAt == nil {
+			letters = append(letters, cloneDeadLetter(entry.letter))
+		}
+	}
+
+	return letters, nil
+}
+
+func (repo *MemoryHouseholdRepository) FindDeadLetter(ctx context.Context, id int64) (*DeadLetter, error) {
+	for _, entry := range repo.deadLetters {
+		if entry.letter.ID == id && entry.replayedAt == nil {
+			dl := cloneDeadLetter(entry.letter)
+			return &dl, nil
+		}
+	}
+
+	return nil, ErrDeadLetterNotFound
+}
+
+func (repo *MemoryHouseholdRepository) MarkReplayed(ctx context.Context, id int64, at time.Time) error {
+	for _, entry := range repo.deadLetters {
+		if entry.letter.ID == id {
+			entry.replayedAt = &at
+		}
+	}
+
+	before := at.Add(-deadLetterRetention)
+	repo.deadLetters = slices.DeleteFunc(repo.deadLetters, func(entry *deadLetterEntry) bool {
+		return entry.replayedAt != nil && entry.replayedAt.Before(before)
+	})
+
+	return nil
+}
+
+func cloneDeadLetter(dl DeadLetter) DeadLetter {
+	dl.Payload = slices.Clone(dl.Payload)
+	return dl
+}
+
+func cloneHousehold(h *domain.Household) *domain.Household {
+	c := *h
+	c.Checklist = slices.Clone(h.Checklist)
+	c.LastNotifiedAt = cloneTime(h.LastNotifiedAt)
+	c.Members = make([]*domain.Member, len(h.Members))
+
+	for i, m := range h.Members {
+		member := *m
+		c.Members[i] = &member
+	}
+
+	return &c
+}
+
+func cloneAssignment(a *domain.Assignment) *domain.Assignment {
+	c := *a
+	c.Items = make([]*domain.AssignmentItem, len(a.Items))
+
+	for i, item := range a.Items {
+		c.Items[i] = cloneAssignmentItem(item)
+	}
+
+	return &c
+}
+
+func cloneAssignmentItem(item *domain.AssignmentItem) *domain.AssignmentItem {
+	c := *item
+	c.CompletedAt = cloneTime(item.CompletedAt)
+
+	return &c
+}
+
+func cloneTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+
+	c := *t
+	return &c
+}
@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/andrewyazura/duty-reminder/internal/domain"
+)
+
+func TestMemoryHouseholdRepository(t *testing.T) {
+	testHouseholdRepository(t, func(t *testing.T) HouseholdRepository {
+		return NewMemoryHouseholdRepository()
+	})
+}
+
+func TestMemorySnapshot(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryHouseholdRepository()
+
+	h := domain.NewHousehold(-1234567898765)
+	if err := repo.Create(ctx, h); err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+
+	snapshot := repo.Snapshot()
+
+	h.Crontab = "0 8 * * *"
+	h.AddMember(&domain.Member{Name: "test1", TelegramID: 1})
+	if err := repo.SaveWithMembers(ctx, h); err != nil {
+		t.Fatalf("SaveWithMembers() failed: %v", err)
+	}
+
+	if err := repo.Create(ctx, domain.NewHousehold(-2)); err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+
+	repo.Restore(snapshot)
+
+	got, err := repo.FindByID(ctx, h.TelegramID)
+	if err != nil {
+		t.Fatalf("FindByID() failed: %v", err)
+	}
+
+	if got.Crontab != "0 9 * * 6" || len(got.Members) != 0 {
+		t.Errorf("got household %+v, want the state before the snapshot", got)
+	}
+
+	if _, err := repo.FindByID(ctx, -2); err == nil {
+		t.Error("household created after the snapshot still exists")
+	}
+}
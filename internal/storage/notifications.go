@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/andrewyazura/duty-reminder/internal/domain"
+)
+
+const foreignKeyViolationCode = "23503"
+
+// occurrenceRetention is how long claims are kept, occurrences older than
+// that can't be delivered anymore
+const occurrenceRetention = 30 * 24 * time.Hour
+
+// ClaimOccurrence records that the occurrence is being handled and reports
+// whether it wasn't claimed before. Concurrent transactions claiming the same
+// occurrence wait for each other, so only one of them gets true.
+// Household's claims older than occurrenceRetention are pruned
+func (repo PostgresHouseholdRepository) ClaimOccurrence(ctx context.Context, o domain.Occurrence) (bool, error) {
+	claimQuery := `
+		INSERT INTO household_notifications (
+			household_telegram_id,
+			scheduled_at
+		) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`
+
+	tag, err := repo.db.Exec(ctx, claimQuery, o.HouseholdID, o.ScheduledAt)
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == foreignKeyViolationCode {
+		return false, ErrHouseholdNotFound
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	pruneQuery := `
+		DELETE FROM household_notifications
+		WHERE household_telegram_id = $1 AND scheduled_at < $2
+	`
+
+	_, err = repo.db.Exec(ctx, pruneQuery, o.HouseholdID, o.ScheduledAt.Add(-occurrenceRetention))
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/andrewyazura/duty-reminder/internal/domain"
+)
+
+const (
+	// outboxRetention is how long dispatched events are kept before they're pruned
+	outboxRetention = 7 * 24 * time.Hour
+	// outboxLease is how long a claimed event is skipped by other claims,
+	// an event whose handlers failed is retried once its claim expires
+	outboxLease = 5 * time.Minute
+	// outboxMaxAttempts is how many times an event is claimed before it's
+	// given up on, given up events are pruned like dispatched ones
+	outboxMaxAttempts = 5
+)
+
+// OutboxEvent is a household event written in the same transaction as
+// the change it describes, it is published once the transaction commits
+type OutboxEvent struct {
+	ID          int64
+	Type        string
+	HouseholdID int64
+	CreatedAt   time.Time
+	// Attempts is how many times the event was claimed, the current claim included
+	Attempts int
+}
+
+func (repo PostgresHouseholdRepository) AddToOutbox(
+	ctx context.Context,
+	eventType string,
+	h *domain.Household,
+	at time.Time,
+) error {
+	insertEventQuery := `
+		INSERT INTO outbox (
+			event_type,
+			household_telegram_id,
+			created_at
+		) VALUES ($1, $2, $3)
+	`
+
+	_, err := repo.db.Exec(ctx, insertEventQuery, eventType, h.TelegramID, at)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ClaimOutbox claims the oldest pending events that aren't claimed already
+// and counts the attempt. Claims last for outboxLease after at and aren't
+// bound to the transaction, so handlers can run after it commits
+func (repo PostgresHouseholdRepository) ClaimOutbox(ctx context.Context, limit int, at time.Time) ([]OutboxEvent, error) {
+	claimEventsQuery := `
+		UPDATE outbox
+		SET
+			attempts = attempts + 1,
+			claimed_until = $2
+		WHERE id IN (
+			SELECT id
+			FROM outbox
+			WHERE
+				dispatched_at IS NULL
+				AND attempts < $3
+				AND (claimed_until IS NULL OR claimed_until <= $1)
+			ORDER BY id ASC
+			LIMIT $4
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING
+			id,
+			event_type,
+			household_telegram_id,
+			created_at,
+			attempts
+	`
+
+	rows, err := repo.db.Query(ctx, claimEventsQuery, at, at.Add(outboxLease), outboxMaxAttempts, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var events []OutboxEvent
+	for rows.Next() {
+		var e OutboxEvent
+		if err := rows.Scan(&e.ID, &e.Type, &e.HouseholdID, &e.CreatedAt, &e.Attempts); err != nil {
+			return nil, err
+		}
+
+		events = append(events, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// RETURNING doesn't keep the order of the subquery
+	slices.SortFunc(events, func(a, b OutboxEvent) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	return events, nil
+}
+
+// MarkDispatched marks the events as dispatched at the time and prunes
+// events dispatched or given up on more than outboxRetention before it
+func (repo PostgresHouseholdRepository) MarkDispatched(ctx context.Context, ids []int64, at time.Time) error {
+	markDispatchedQuery := `
+		UPDATE outbox
+		SET dispatched_at = $1
+		WHERE id = ANY($2)
+	`
+
+	_, err := repo.db.Exec(ctx, markDispatchedQuery, at, ids)
+	if err != nil {
+		return err
+	}
+
+	pruneQuery := `
+		DELETE FROM outbox
+		WHERE
+			dispatched_at < $1
+			OR (dispatched_at IS NULL AND attempts >= $2 AND created_at < $1)
+	`
+
+	_, err = repo.db.Exec(ctx, pruneQuery, at.Add(-outboxRetention), outboxMaxAttempts)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -3,6 +3,8 @@ package storage
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
@@ -10,12 +12,39 @@ import (
 	"github.com/andrewyazura/duty-reminder/internal/domain"
 )
 
+var (
+	ErrHouseholdNotFound  = errors.New("household not found")
+	ErrHouseholdExists    = errors.New("household already exists")
+	ErrAssignmentNotFound = errors.New("assignment not found")
+	ErrDeadLetterNotFound = errors.New("dead letter not found")
+)
+
+const uniqueViolationCode = "23505"
+
 type HouseholdRepository interface {
 	Create(ctx context.Context, h *domain.Household) error
 	Save(ctx context.Context, h *domain.Household) error
 	SaveWithMembers(ctx context.Context, h *domain.Household) error
 	FindByID(ctx context.Context, telegramID int64) (*domain.Household, error)
 	GetSchedules(ctx context.Context) ([]*domain.Household, error)
+
+	CreateAssignment(ctx context.Context, a *domain.Assignment) error
+	SaveAssignment(ctx context.Context, a *domain.Assignment) error
+	FindAssignment(ctx context.Context, id int64) (*domain.Assignment, error)
+	ReassignLatest(ctx context.Context, householdID int64, memberID int64) error
+	LatestAssignmentIDs(ctx context.Context) ([]int64, error)
+	ClaimReminder(ctx context.Context, r domain.Reminder) (bool, error)
+
+	ClaimOccurrence(ctx context.Context, o domain.Occurrence) (bool, error)
+
+	AddToOutbox(ctx context.Context, eventType string, h *domain.Household, at time.Time) error
+	ClaimOutbox(ctx context.Context, limit int, at time.Time) ([]OutboxEvent, error)
+	MarkDispatched(ctx context.Context, ids []int64, at time.Time) error
+
+	AddDeadLetter(ctx context.Context, dl *DeadLetter) error
+	PendingDeadLetters(ctx context.Context, limit int) ([]DeadLetter, error)
+	FindDeadLetter(ctx context.Context, id int64) (*DeadLetter, error)
+	MarkReplayed(ctx context.Context, id int64, at time.Time) error
 }
 
 type Querier interface {
@@ -40,8 +69,13 @@ func (repo PostgresHouseholdRepository) Create(ctx context.Context, h *domain.Ho
 			telegram_id,
 			checklist,
 			crontab,
-			current_member_index
-		) VALUES ($1, $2, $3, $4)
+			current_member_index,
+			timezone,
+			reminder_delay_hours,
+			escalation_delay_hours,
+			last_notified_at,
+			on_duty_telegram_id
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, 0))
 	`
 
 	_, err := repo.db.Exec(
@@ -51,8 +85,18 @@ func (repo PostgresHouseholdRepository) Create(ctx context.Context, h *domain.Ho
 		h.Checklist,
 		h.Crontab,
 		h.CurrentMember,
+		h.TimeZone,
+		toHours(h.ReminderDelay),
+		toHours(h.EscalationDelay),
+		h.LastNotifiedAt,
+		h.OnDutyID,
 	)
 
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolationCode {
+		return ErrHouseholdExists
+	}
+
 	if err != nil {
 		return err
 	}
@@ -63,8 +107,16 @@ func (repo PostgresHouseholdRepository) Create(ctx context.Context, h *domain.Ho
 func (repo PostgresHouseholdRepository) Save(ctx context.Context, h *domain.Household) error {
 	updateHouseholdQuery := `
 		UPDATE households
-		SET checklist = $1, crontab = $2, current_member_index = $3
-		WHERE telegram_id = $4
+		SET
+			checklist = $1,
+			crontab = $2,
+			current_member_index = $3,
+			timezone = $4,
+			reminder_delay_hours = $5,
+			escalation_delay_hours = $6,
+			last_notified_at = $7,
+			on_duty_telegram_id = NULLIF($8, 0)
+		WHERE telegram_id = $9
 	`
 
 	_, err := repo.db.Exec(
@@ -73,6 +125,11 @@ func (repo PostgresHouseholdRepository) Save(ctx context.Context, h *domain.Hous
 		h.Checklist,
 		h.Crontab,
 		h.CurrentMember,
+		h.TimeZone,
+		toHours(h.ReminderDelay),
+		toHours(h.EscalationDelay),
+		h.LastNotifiedAt,
+		h.OnDutyID,
 		h.TelegramID,
 	)
 
@@ -108,6 +165,7 @@ func (repo PostgresHouseholdRepository) SaveWithMembers(ctx context.Context, h *
 			h.TelegramID,
 			m.TelegramID,
 			m.Name,
+			m.Username,
 			m.Order,
 		}
 	}
@@ -119,6 +177,7 @@ func (repo PostgresHouseholdRepository) SaveWithMembers(ctx context.Context, h *
 			"household_telegram_id",
 			"telegram_id",
 			"name",
+			"username",
 			"order",
 		},
 		pgx.CopyFromRows(rows),
@@ -129,29 +188,56 @@ func (repo PostgresHouseholdRepository) SaveWithMembers(ctx context.Context, h *
 	return nil
 }
 
+// FindByID locks the household row until the transaction ends, so read,
+// modify and save cycles of concurrent transactions run one after another.
+// Outside of a transaction the lock is released right away
 func (repo PostgresHouseholdRepository) FindByID(ctx context.Context, telegramID int64) (*domain.Household, error) {
 	householdQuery := `
 		SELECT 
 			checklist,
 			crontab,
-			current_member_index
+			current_member_index,
+			timezone,
+			reminder_delay_hours,
+			escalation_delay_hours,
+			last_notified_at,
+			COALESCE(on_duty_telegram_id, 0)
 		FROM households
 		WHERE telegram_id = $1
+		FOR UPDATE
 	`
 
 	h := &domain.Household{TelegramID: telegramID}
+	var reminderDelayHours, escalationDelayHours int
 
 	row := repo.db.QueryRow(ctx, householdQuery, telegramID)
-	err := row.Scan(&h.Checklist, &h.Crontab, &h.CurrentMember)
+	err := row.Scan(
+		&h.Checklist,
+		&h.Crontab,
+		&h.CurrentMember,
+		&h.TimeZone,
+		&reminderDelayHours,
+		&escalationDelayHours,
+		&h.LastNotifiedAt,
+		&h.OnDutyID,
+	)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrHouseholdNotFound
+	}
 
 	if err != nil {
 		return nil, err
 	}
 
+	h.ReminderDelay = time.Duration(reminderDelayHours) * time.Hour
+	h.EscalationDelay = time.Duration(escalationDelayHours) * time.Hour
+
 	membersQuery := `
 		SELECT
 			telegram_id,
 			name,
+			username,
 			"order"
 		FROM members
 		WHERE
@@ -170,7 +256,12 @@ func (repo PostgresHouseholdRepository) FindByID(ctx context.Context, telegramID
 	h.Members = []*domain.Member{}
 	for rows.Next() {
 		member := &domain.Member{}
-		if err := rows.Scan(&member.TelegramID, &member.Name, &member.Order); err != nil {
+		if err := rows.Scan(
+			&member.TelegramID,
+			&member.Name,
+			&member.Username,
+			&member.Order,
+		); err != nil {
 			return nil, err
 		}
 
@@ -185,7 +276,9 @@ func (repo PostgresHouseholdRepository) GetSchedules(ctx context.Context) ([]*do
 		SELECT
 			telegram_id,
 			checklist,
-			crontab
+			crontab,
+			timezone,
+			last_notified_at
 		FROM households
 	`
 
@@ -197,7 +290,13 @@ func (repo PostgresHouseholdRepository) GetSchedules(ctx context.Context) ([]*do
 	var households []*domain.Household
 	for rows.Next() {
 		h := &domain.Household{}
-		err := rows.Scan(&h.TelegramID, &h.Checklist, &h.Crontab)
+		err := rows.Scan(
+			&h.TelegramID,
+			&h.Checklist,
+			&h.Crontab,
+			&h.TimeZone,
+			&h.LastNotifiedAt,
+		)
 
 		if err != nil {
 			return nil, err
@@ -212,3 +311,7 @@ func (repo PostgresHouseholdRepository) GetSchedules(ctx context.Context) ([]*do
 
 	return households, nil
 }
+
+func toHours(d time.Duration) int {
+	return int(d / time.Hour)
+}
@@ -4,11 +4,12 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"io"
 	"log/slog"
-	"os"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/andrewyazura/duty-reminder/internal/domain"
 	"github.com/andrewyazura/duty-reminder/internal/testutils"
@@ -39,10 +40,6 @@ func setupTestDatabase(t *testing.T) (Querier, func()) {
 		t.Fatalf("failed to start a transaction: %v", err)
 	}
 
-	if err := applySchema(transaction); err != nil {
-		t.Fatalf("failed to apply sql schema: %v", err)
-	}
-
 	teardownFunc := func() {
 		err := transaction.Rollback(context.Background())
 
@@ -54,17 +51,13 @@ func setupTestDatabase(t *testing.T) (Querier, func()) {
 	return transaction, teardownFunc
 }
 
-func applySchema(db Querier) error {
-	data, err := os.ReadFile("../../sql/schema.sql")
-	if err != nil {
-		return err
-	}
-
-	if _, err := db.Exec(context.Background(), string(data)); err != nil {
-		return err
-	}
+func TestPostgresHouseholdRepository(t *testing.T) {
+	testHouseholdRepository(t, func(t *testing.T) HouseholdRepository {
+		querier, teardownFunc := setupTestDatabase(t)
+		t.Cleanup(teardownFunc)
 
-	return nil
+		return NewPostgresHouseholdRepository(querier)
+	})
 }
 
 func TestFindByID(t *testing.T) {
@@ -178,6 +171,57 @@ func TestFindByID(t *testing.T) {
 	})
 }
 
+func TestFindByIDNotFound(t *testing.T) {
+	querier, teardownFunc := setupTestDatabase(t)
+	defer teardownFunc()
+
+	ctx := context.Background()
+	repo := PostgresHouseholdRepository{db: querier}
+
+	_, err := repo.FindByID(ctx, -1234567898765)
+	if !errors.Is(err, ErrHouseholdNotFound) {
+		t.Fatalf("got error %v, want %v", err, ErrHouseholdNotFound)
+	}
+}
+
+func TestCreate(t *testing.T) {
+	querier, teardownFunc := setupTestDatabase(t)
+	defer teardownFunc()
+
+	ctx := context.Background()
+	repo := PostgresHouseholdRepository{db: querier}
+
+	t.Run("success", func(t *testing.T) {
+		want := domain.NewHousehold(-1234567898765)
+		want.TimeZone = "Europe/Kyiv"
+
+		if err := repo.Create(ctx, want); err != nil {
+			t.Fatalf("Create() failed: %v", err)
+		}
+
+		got, err := repo.FindByID(ctx, want.TelegramID)
+		if err != nil {
+			t.Fatalf("FindByID() failed: %v", err)
+		}
+
+		if got.Crontab != want.Crontab || got.TimeZone != want.TimeZone {
+			t.Errorf("got household %v, want %v", got, want)
+		}
+	})
+
+	t.Run("already exists", func(t *testing.T) {
+		h := domain.NewHousehold(-2234567898765)
+
+		if err := repo.Create(ctx, h); err != nil {
+			t.Fatalf("Create() failed: %v", err)
+		}
+
+		if err := repo.Create(ctx, h); !errors.Is(err, ErrHouseholdExists) {
+			t.Fatalf("got error %v, want %v", err, ErrHouseholdExists)
+		}
+	})
+}
+
 func TestSaveWithMembers(t *testing.T) {
 	querier, teardownFunc := setupTestDatabase(t)
 	defer teardownFunc()
@@ -301,3 +345,61 @@ func TestGetSchedules(t *testing.T) {
 		}
 	})
 }
+
+func TestAssignments(t *testing.T) {
+	querier, teardownFunc := setupTestDatabase(t)
+	defer teardownFunc()
+
+	ctx := context.Background()
+	repo := PostgresHouseholdRepository{db: querier}
+
+	t.Run("success", func(t *testing.T) {
+		h := domain.NewHousehold(-1234567898765)
+		h.Checklist = []string{"point 1", "point 2"}
+		h.AddMember(&domain.Member{Name: "test1", TelegramID: 1})
+
+		if err := repo.Create(ctx, h); err != nil {
+			t.Fatalf("Create() failed: %v", err)
+		}
+
+		now := time.Date(2025, 1, 4, 9, 0, 0, 0, time.UTC)
+		want := domain.NewAssignment(h, h.Members[0], now)
+
+		if err := repo.CreateAssignment(ctx, want); err != nil {
+			t.Fatalf("CreateAssignment() failed: %v", err)
+		}
+
+		if want.ID == 0 {
+			t.Fatalf("assignment id was not set")
+		}
+
+		if err := want.CompleteItem(1, 1, now); err != nil {
+			t.Fatalf("CompleteItem() failed: %v", err)
+		}
+
+		if err := repo.SaveAssignment(ctx, want); err != nil {
+			t.Fatalf("SaveAssignment() failed: %v", err)
+		}
+
+		got, err := repo.FindAssignment(ctx, want.ID)
+		if err != nil {
+			t.Fatalf("FindAssignment() failed: %v", err)
+		}
+
+		if got.HouseholdID != want.HouseholdID || got.MemberID != want.MemberID {
+			t.Errorf("got assignment %v, want %v", got, want)
+		}
+
+		if len(got.Items) != 2 {
+			t.Fatalf("got %d items, want %d", len(got.Items), 2)
+		}
+
+		if got.Items[0].IsCompleted() {
+			t.Errorf("item %s is completed, want not completed", got.Items[0].Name)
+		}
+
+		if item := got.Items[1]; item.CompletedBy != 1 || !item.CompletedAt.Equal(now) {
+			t.Errorf("item completed by %d at %v, want %d at %v", item.CompletedBy, item.CompletedAt, 1, now)
+		}
+	})
+}
@@ -4,47 +4,122 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/andrewyazura/duty-reminder/internal/config"
 )
 
 type Result struct {
-	Ok          bool            `json:"ok"`
-	Description string          `json:"description"`
-	Result      json.RawMessage `json:"result,omitempty"`
+	Ok          bool                `json:"ok"`
+	Description string              `json:"description"`
+	ErrorCode   int                 `json:"error_code,omitempty"`
+	Parameters  *ResponseParameters `json:"parameters,omitempty"`
+	Result      json.RawMessage     `json:"result,omitempty"`
 }
 
+type ResponseParameters struct {
+	MigrateToChatID int64 `json:"migrate_to_chat_id,omitempty"`
+	RetryAfter      int   `json:"retry_after,omitempty"`
+}
+
+// Client is safe for concurrent use and should be shared,
+// so that its rate limiter sees all outgoing messages
 type Client struct {
-	config *config.TelegramConfig
-	client *http.Client
-	logger *slog.Logger
+	config       *config.TelegramConfig
+	client       *http.Client
+	limiter      *rateLimiter
+	logger       *slog.Logger
+	retryBackoff time.Duration
+}
+
+type ClientOption func(*Client)
+
+// WithoutRateLimit sends requests as soon as they're made, it's meant for
+// tests against a fake bot api
+func WithoutRateLimit() ClientOption {
+	return func(c *Client) {
+		c.limiter = nil
+	}
 }
 
-func NewClient(config *config.TelegramConfig, logger *slog.Logger) *Client {
-	return &Client{
+func NewClient(config *config.TelegramConfig, logger *slog.Logger, opts ...ClientOption) *Client {
+	c := &Client{
 		config: config,
 		client: &http.Client{
 			Timeout: config.Timeout,
 		},
-		logger: logger,
+		limiter:      newRateLimiter(),
+		logger:       logger,
+		retryBackoff: time.Second,
 	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
 }
 
 func (c *Client) buildURL(endpoint string) string {
 	return fmt.Sprintf("%s/bot%s/%s", c.config.BaseURL, c.config.APIToken, endpoint)
 }
 
+// postJSON sends a request to the bot api, waiting for the rate limiter and
+// retrying on flood limits and server errors until MaxRetries is reached or ctx is done
 func (c *Client) postJSON(ctx context.Context, endpoint string, data any) (json.RawMessage, error) {
 	jsonData, err := json.Marshal(data)
 	if err != nil {
-		c.logger.Error("failed to marshal request json", "endpoint", endpoint, "error", err)
+		c.logger.ErrorContext(ctx, "failed to marshal request json", "endpoint", endpoint, "error", err)
 		return nil, err
 	}
 
+	for attempt := 0; ; attempt++ {
+		if p, ok := data.(chatPayload); ok && c.limiter != nil {
+			if err := c.limiter.Wait(ctx, p.chatID()); err != nil {
+				return nil, err
+			}
+		}
+
+		result, err := c.post(ctx, endpoint, jsonData)
+		if err == nil {
+			return result, nil
+		}
+
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || !apiErr.Temporary() || attempt >= c.config.MaxRetries {
+			return nil, err
+		}
+
+		delay := apiErr.RetryAfter
+		if delay == 0 {
+			delay = c.retryBackoff << attempt
+		}
+
+		c.logger.WarnContext(
+			ctx,
+			"retrying telegram api request",
+			"endpoint", endpoint,
+			"attempt", attempt+1,
+			"delay", delay,
+			"error", err,
+		)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, errors.Join(err, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *Client) post(ctx context.Context, endpoint string, jsonData []byte) (json.RawMessage, error) {
 	url := c.buildURL(endpoint)
 	reqBody := bytes.NewBuffer(jsonData)
 	req, err := http.NewRequestWithContext(
@@ -54,12 +129,13 @@ func (c *Client) postJSON(ctx context.Context, endpoint string, data any) (json.
 		reqBody,
 	)
 	if err != nil {
-		c.logger.Error("failed to create http request", "endpoint", endpoint, "error", err)
+		c.logger.ErrorContext(ctx, "failed to create http request", "endpoint", endpoint, "error", err)
 		return nil, err
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	c.logger.Debug(
+	c.logger.DebugContext(
+		ctx,
 		"sending telegram api request",
 		"endpoint",
 		endpoint,
@@ -69,28 +145,46 @@ func (c *Client) postJSON(ctx context.Context, endpoint string, data any) (json.
 
 	resp, err := c.client.Do(req)
 	if err != nil {
-		c.logger.Error("http request failed", "endpoint", endpoint, "error", err)
+		c.logger.ErrorContext(ctx, "http request failed", "endpoint", endpoint, "error", err)
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	c.logger.Debug("received telegram api response", "status_code", resp.StatusCode)
+	c.logger.DebugContext(ctx, "received telegram api response", "status_code", resp.StatusCode)
 
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		c.logger.Error("failed to read response body", "endpoint", endpoint, "error", err)
+		c.logger.ErrorContext(ctx, "failed to read response body", "endpoint", endpoint, "error", err)
 		return nil, err
 	}
 
 	var result Result
 	if err := json.Unmarshal(respBody, &result); err != nil {
-		c.logger.Error("failed to decode response body", "endpoint", endpoint, "body", string(respBody), "error", err)
+		c.logger.ErrorContext(ctx, "failed to decode response body", "endpoint", endpoint, "body", string(respBody), "error", err)
+
+		// proxies in front of the bot api may respond with a non-json body
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return nil, &APIError{Code: resp.StatusCode, Description: http.StatusText(resp.StatusCode)}
+		}
+
 		return nil, err
 	}
 
 	if !result.Ok {
-		err := fmt.Errorf("telegram api error: %s", result.Description)
-		c.logger.Error("telegram api returned an error", "endpoint", endpoint, "error", err)
+		err := &APIError{
+			Code:        result.ErrorCode,
+			Description: result.Description,
+		}
+
+		if err.Code == 0 {
+			err.Code = resp.StatusCode
+		}
+
+		if p := result.Parameters; p != nil {
+			err.RetryAfter = time.Duration(p.RetryAfter) * time.Second
+		}
+
+		c.logger.ErrorContext(ctx, "telegram api returned an error", "endpoint", endpoint, "error", err)
 		return nil, err
 	}
 
@@ -139,13 +233,68 @@ func (c *Client) GetMe(ctx context.Context) (*User, error) {
 
 	var user User
 	if err := json.Unmarshal(rawResult, &user); err != nil {
-		c.logger.Error("failed to decode getMe result", "result", string(rawResult), "error", err)
+		c.logger.ErrorContext(ctx, "failed to decode getMe result", "result", string(rawResult), "error", err)
 		return nil, err
 	}
 
 	return &user, nil
 }
 
+func (c *Client) GetChatMember(ctx context.Context, chatID int64, userID int64) (*ChatMember, error) {
+	rawResult, err := c.postJSON(ctx, "getChatMember", getChatMemberPayload{
+		ChatID: chatID,
+		UserID: userID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var member ChatMember
+	if err := json.Unmarshal(rawResult, &member); err != nil {
+		c.logger.ErrorContext(ctx, "failed to decode getChatMember result", "result", string(rawResult), "error", err)
+		return nil, err
+	}
+
+	return &member, nil
+}
+
+func (c *Client) SetWebhook(url string) *SetWebhookBuilder {
+	return &SetWebhookBuilder{
+		client: c,
+		payload: setWebhookPayload{
+			URL: url,
+		},
+	}
+}
+
+func (c *Client) DeleteWebhook() *DeleteWebhookBuilder {
+	return &DeleteWebhookBuilder{client: c}
+}
+
+func (c *Client) GetWebhookInfo(ctx context.Context) (*WebhookInfo, error) {
+	rawResult, err := c.postJSON(ctx, "getWebhookInfo", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var info WebhookInfo
+	if err := json.Unmarshal(rawResult, &info); err != nil {
+		c.logger.ErrorContext(ctx, "failed to decode getWebhookInfo result", "result", string(rawResult), "error", err)
+		return nil, err
+	}
+
+	return &info, nil
+}
+
+func (c *Client) SetMyCommands(commands []BotCommand) *SetMyCommandsBuilder {
+	return &SetMyCommandsBuilder{
+		client: c,
+		payload: setMyCommandsPayload{
+			Commands: commands,
+		},
+	}
+}
+
 type SendMessageBuilder struct {
 	client  *Client
 	payload sendMessagePayload
@@ -207,3 +356,59 @@ func (b *AnswerCallbackQueryBuilder) Execute(ctx context.Context) error {
 	_, err := b.client.postJSON(ctx, "answerCallbackQuery", b.payload)
 	return err
 }
+
+type SetWebhookBuilder struct {
+	client  *Client
+	payload setWebhookPayload
+}
+
+func (b *SetWebhookBuilder) WithSecretToken(secretToken string) *SetWebhookBuilder {
+	b.payload.SecretToken = &secretToken
+	return b
+}
+
+func (b *SetWebhookBuilder) WithAllowedUpdates(allowedUpdates ...string) *SetWebhookBuilder {
+	b.payload.AllowedUpdates = allowedUpdates
+	return b
+}
+
+func (b *SetWebhookBuilder) WithDropPendingUpdates(dropPendingUpdates bool) *SetWebhookBuilder {
+	b.payload.DropPendingUpdates = &dropPendingUpdates
+	return b
+}
+
+func (b *SetWebhookBuilder) Execute(ctx context.Context) error {
+	_, err := b.client.postJSON(ctx, "setWebhook", b.payload)
+	return err
+}
+
+type DeleteWebhookBuilder struct {
+	client  *Client
+	payload deleteWebhookPayload
+}
+
+func (b *DeleteWebhookBuilder) WithDropPendingUpdates(dropPendingUpdates bool) *DeleteWebhookBuilder {
+	b.payload.DropPendingUpdates = &dropPendingUpdates
+	return b
+}
+
+func (b *DeleteWebhookBuilder) Execute(ctx context.Context) error {
+	_, err := b.client.postJSON(ctx, "deleteWebhook", b.payload)
+	return err
+}
+
+type SetMyCommandsBuilder struct {
+	client  *Client
+	payload setMyCommandsPayload
+}
+
+// WithScope limits the commands to a scope type, e.g. "all_group_chats"
+func (b *SetMyCommandsBuilder) WithScope(scopeType string) *SetMyCommandsBuilder {
+	b.payload.Scope = &botCommandScope{Type: scopeType}
+	return b
+}
+
+func (b *SetMyCommandsBuilder) Execute(ctx context.Context) error {
+	_, err := b.client.postJSON(ctx, "setMyCommands", b.payload)
+	return err
+}
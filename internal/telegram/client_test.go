@@ -3,6 +3,7 @@ package telegram
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"log/slog"
 	"net/http"
@@ -36,7 +37,7 @@ func getTestClient(t *testing.T) (*Client, *mockHandler, func()) {
 	}
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
 
-	testClient := NewClient(&testConfig, logger)
+	testClient := NewClient(&testConfig, logger, WithoutRateLimit()) // covered in ratelimit_test.go
 
 	teardownFunc := func() {
 		server.Close()
@@ -306,3 +307,331 @@ func TestGetMe(t *testing.T) {
 		}
 	})
 }
+
+func TestGetChatMember(t *testing.T) {
+	client, handler, teardown := getTestClient(t)
+	defer teardown()
+
+	ctx := context.Background()
+
+	t.Run("success", func(t *testing.T) {
+		handler.handler = func(w http.ResponseWriter, r *http.Request) {
+			if !strings.HasSuffix(r.URL.Path, "/getChatMember") {
+				t.Errorf("got endpoint %s, want %s", r.URL.Path, "/getChatMember")
+			}
+
+			var got getChatMemberPayload
+			if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+				t.Fatalf("failed to unmarshal request body: %v", err)
+			}
+
+			if got.ChatID != -1234567898765 || got.UserID != 1 {
+				t.Errorf("got chat_id %d and user_id %d, want %d and %d", got.ChatID, got.UserID, -1234567898765, 1)
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			io.WriteString(w, `{
+				"ok": true,
+				"result": {
+					"status": "administrator",
+					"user": {"id": 1, "first_name": "test_first_name"}
+				}
+			}`)
+		}
+
+		got, err := client.GetChatMember(ctx, -1234567898765, 1)
+		if err != nil {
+			t.Fatalf("GetChatMember() returned an error: %v", err)
+		}
+
+		if !got.IsAdmin() {
+			t.Errorf("got status %s, want an admin", got.Status)
+		}
+
+		if got.User.ID != 1 {
+			t.Errorf("got user id %d, want %d", got.User.ID, 1)
+		}
+	})
+}
+
+func TestSetWebhook(t *testing.T) {
+	client, handler, teardown := getTestClient(t)
+	defer teardown()
+
+	ctx := context.Background()
+
+	t.Run("success", func(t *testing.T) {
+		handler.handler = func(w http.ResponseWriter, r *http.Request) {
+			if !strings.HasSuffix(r.URL.Path, "/setWebhook") {
+				t.Errorf("got endpoint %s, want %s", r.URL.Path, "/setWebhook")
+			}
+
+			var got setWebhookPayload
+			if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+				t.Fatalf("failed to unmarshal request body: %v", err)
+			}
+
+			if got.URL != "https://example.com/telegram/abc" {
+				t.Errorf("url is %s, want %s", got.URL, "https://example.com/telegram/abc")
+			}
+
+			if got.SecretToken == nil || *got.SecretToken != "secret" {
+				t.Errorf("secret_token is %v, want %s", got.SecretToken, "secret")
+			}
+
+			if !reflect.DeepEqual(got.AllowedUpdates, []string{"message", "callback_query"}) {
+				t.Errorf("allowed_updates is %v, want %v", got.AllowedUpdates, []string{"message", "callback_query"})
+			}
+
+			if got.DropPendingUpdates != nil {
+				t.Errorf("expected drop_pending_updates to be omitted")
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			io.WriteString(w, `{"ok": true, "result": true}`)
+		}
+
+		err := client.SetWebhook("https://example.com/telegram/abc").
+			WithSecretToken("secret").
+			WithAllowedUpdates("message", "callback_query").
+			Execute(ctx)
+
+		if err != nil {
+			t.Errorf("SetWebhook().Execute() returned an error: %v", err)
+		}
+	})
+}
+
+func TestDeleteWebhook(t *testing.T) {
+	client, handler, teardown := getTestClient(t)
+	defer teardown()
+
+	ctx := context.Background()
+
+	t.Run("success", func(t *testing.T) {
+		handler.handler = func(w http.ResponseWriter, r *http.Request) {
+			if !strings.HasSuffix(r.URL.Path, "/deleteWebhook") {
+				t.Errorf("got endpoint %s, want %s", r.URL.Path, "/deleteWebhook")
+			}
+
+			var got deleteWebhookPayload
+			if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+				t.Fatalf("failed to unmarshal request body: %v", err)
+			}
+
+			if got.DropPendingUpdates == nil || !*got.DropPendingUpdates {
+				t.Errorf("drop_pending_updates is %v, want %t", got.DropPendingUpdates, true)
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			io.WriteString(w, `{"ok": true, "result": true}`)
+		}
+
+		err := client.DeleteWebhook().WithDropPendingUpdates(true).Execute(ctx)
+
+		if err != nil {
+			t.Errorf("DeleteWebhook().Execute() returned an error: %v", err)
+		}
+	})
+}
+
+func TestGetWebhookInfo(t *testing.T) {
+	client, handler, teardown := getTestClient(t)
+	defer teardown()
+
+	ctx := context.Background()
+
+	t.Run("success", func(t *testing.T) {
+		handler.handler = func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			io.WriteString(w, `{
+				"ok": true,
+				"result": {
+					"url": "https://example.com/telegram/abc",
+					"pending_update_count": 3,
+					"last_error_message": "connection refused"
+				}
+			}`)
+		}
+
+		want := WebhookInfo{
+			URL:                "https://example.com/telegram/abc",
+			PendingUpdateCount: 3,
+			LastErrorMessage:   "connection refused",
+		}
+
+		got, err := client.GetWebhookInfo(ctx)
+		if err != nil {
+			t.Fatalf("GetWebhookInfo() returned an error: %v", err)
+		}
+
+		if !reflect.DeepEqual(got, &want) {
+			t.Errorf("got %v, want %v", got, &want)
+		}
+	})
+}
+
+func TestSetMyCommands(t *testing.T) {
+	client, handler, teardown := getTestClient(t)
+	defer teardown()
+
+	ctx := context.Background()
+
+	t.Run("success", func(t *testing.T) {
+		want := []BotCommand{
+			{Command: "register", Description: "become a member of the household"},
+			{Command: "help", Description: "show this list of commands"},
+		}
+
+		handler.handler = func(w http.ResponseWriter, r *http.Request) {
+			if !strings.HasSuffix(r.URL.Path, "/setMyCommands") {
+				t.Errorf("got endpoint %s, want %s", r.URL.Path, "/setMyCommands")
+			}
+
+			var got setMyCommandsPayload
+			if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+				t.Fatalf("failed to unmarshal request body: %v", err)
+			}
+
+			if !reflect.DeepEqual(got.Commands, want) {
+				t.Errorf("commands are %v, want %v", got.Commands, want)
+			}
+
+			if got.Scope == nil || got.Scope.Type != "all_group_chats" {
+				t.Errorf("scope is %v, want %s", got.Scope, "all_group_chats")
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			io.WriteString(w, `{"ok": true, "result": true}`)
+		}
+
+		err := client.SetMyCommands(want).WithScope("all_group_chats").Execute(ctx)
+
+		if err != nil {
+			t.Errorf("SetMyCommands().Execute() returned an error: %v", err)
+		}
+	})
+}
+
+func TestRetries(t *testing.T) {
+	client, handler, teardown := getTestClient(t)
+	defer teardown()
+
+	client.config.MaxRetries = 2
+	client.retryBackoff = time.Millisecond
+
+	ctx := context.Background()
+
+	t.Run("success after server error", func(t *testing.T) {
+		calls := 0
+		handler.handler = func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls == 1 {
+				w.WriteHeader(http.StatusBadGateway)
+				io.WriteString(w, "<html>502 Bad Gateway</html>")
+				return
+			}
+
+			w.WriteHeader(http.StatusOK)
+			io.WriteString(w, `{"ok": true, "result": {}}`)
+		}
+
+		if err := client.SendMessage(1, "t").Execute(ctx); err != nil {
+			t.Fatalf("SendMessage().Execute() returned an error: %v", err)
+		}
+
+		if calls != 2 {
+			t.Errorf("got %d calls, want %d", calls, 2)
+		}
+	})
+
+	t.Run("success after flood limit", func(t *testing.T) {
+		calls := 0
+		handler.handler = func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls == 1 {
+				w.WriteHeader(http.StatusTooManyRequests)
+				io.WriteString(w, `{
+					"ok": false,
+					"error_code": 429,
+					"description": "Too Many Requests: retry after 1",
+					"parameters": {"retry_after": 1}
+				}`)
+				return
+			}
+
+			w.WriteHeader(http.StatusOK)
+			io.WriteString(w, `{"ok": true, "result": {}}`)
+		}
+
+		start := time.Now()
+		if err := client.SendMessage(1, "t").Execute(ctx); err != nil {
+			t.Fatalf("SendMessage().Execute() returned an error: %v", err)
+		}
+
+		if elapsed := time.Since(start); elapsed < time.Second {
+			t.Errorf("retried after %v, want at least %v", elapsed, time.Second)
+		}
+	})
+
+	t.Run("no retry on client error", func(t *testing.T) {
+		calls := 0
+		handler.handler = func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"ok": false, "error_code": 400, "description": "Bad Request: chat not found"}`)
+		}
+
+		err := client.SendMessage(1, "t").Execute(ctx)
+
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) {
+			t.Fatalf("got error %v, want an *APIError", err)
+		}
+
+		if apiErr.Code != http.StatusBadRequest {
+			t.Errorf("got error code %d, want %d", apiErr.Code, http.StatusBadRequest)
+		}
+
+		if calls != 1 {
+			t.Errorf("got %d calls, want %d", calls, 1)
+		}
+	})
+
+	t.Run("gives up after max retries", func(t *testing.T) {
+		calls := 0
+		handler.handler = func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, `{"ok": false, "error_code": 500, "description": "Internal Server Error"}`)
+		}
+
+		if err := client.SendMessage(1, "t").Execute(ctx); err == nil {
+			t.Fatal("SendMessage().Execute() did not return an error")
+		}
+
+		if calls != 3 {
+			t.Errorf("got %d calls, want %d", calls, 3)
+		}
+	})
+
+	t.Run("stops when context is done", func(t *testing.T) {
+		handler.handler = func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTooManyRequests)
+			io.WriteString(w, `{"ok": false, "error_code": 429, "parameters": {"retry_after": 60}}`)
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+
+		err := client.SendMessage(1, "t").Execute(ctx)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("got error %v, want %v", err, context.DeadlineExceeded)
+		}
+	})
+}
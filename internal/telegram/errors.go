@@ -0,0 +1,23 @@
+package telegram
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// APIError is returned when the bot api responds with ok set to false
+type APIError struct {
+	Code        int
+	Description string
+	RetryAfter  time.Duration
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("telegram api error %d: %s", e.Code, e.Description)
+}
+
+// Temporary reports whether the request may succeed if it's sent again
+func (e *APIError) Temporary() bool {
+	return e.Code == http.StatusTooManyRequests || e.Code >= http.StatusInternalServerError
+}
@@ -0,0 +1,65 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/andrewyazura/duty-reminder/internal/eventbus"
+)
+
+const pollingRetryDelay = 5 * time.Second
+
+func (c *Client) GetUpdates(ctx context.Context, offset int) ([]Update, error) {
+	rawResult, err := c.postJSON(ctx, "getUpdates", getUpdatesPayload{
+		Offset:         offset,
+		Timeout:        int(c.config.PollingTimeout / time.Second),
+		AllowedUpdates: []string{"message", "callback_query"},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var updates []Update
+	if err := json.Unmarshal(rawResult, &updates); err != nil {
+		c.logger.ErrorContext(ctx, "failed to decode getUpdates result", "result", string(rawResult), "error", err)
+		return nil, err
+	}
+
+	return updates, nil
+}
+
+// PollUpdates long-polls the bot api and publishes every update to the topic
+// the same way the webhook does. It blocks until ctx is cancelled
+func (c *Client) PollUpdates(
+	ctx context.Context,
+	bus *eventbus.EventBus,
+	topic eventbus.Topic[Update],
+) {
+	c.logger.InfoContext(ctx, "polling for updates")
+	offset := 0
+
+	for {
+		updates, err := c.GetUpdates(ctx, offset)
+
+		if ctx.Err() != nil {
+			c.logger.InfoContext(ctx, "stopped polling for updates")
+			return
+		}
+
+		if err != nil {
+			c.logger.ErrorContext(ctx, "failed to get updates, retrying", "offset", offset, "error", err)
+
+			select {
+			case <-ctx.Done():
+			case <-time.After(pollingRetryDelay):
+			}
+			continue
+		}
+
+		for _, update := range updates {
+			topic.Publish(ctx, bus, update)
+			offset = update.UpdateID + 1
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andrewyazura/duty-reminder/internal/eventbus"
+)
+
+func TestGetUpdates(t *testing.T) {
+	client, handler, teardown := getTestClient(t)
+	defer teardown()
+
+	ctx := context.Background()
+
+	t.Run("success", func(t *testing.T) {
+		handler.handler = func(w http.ResponseWriter, r *http.Request) {
+			if !strings.HasSuffix(r.URL.Path, "/getUpdates") {
+				t.Errorf("got endpoint %s, want %s", r.URL.Path, "/getUpdates")
+			}
+
+			var got getUpdatesPayload
+			if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+				t.Fatalf("failed to unmarshal request body: %v", err)
+			}
+
+			if got.Offset != 10 {
+				t.Errorf("offset is %d, want %d", got.Offset, 10)
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			io.WriteString(w, `{
+				"ok": true,
+				"result": [
+					{"update_id": 10, "message": {"message_id": 1, "text": "hi"}},
+					{"update_id": 11, "message": {"message_id": 2, "text": "hello"}}
+				]
+			}`)
+		}
+
+		got, err := client.GetUpdates(ctx, 10)
+		if err != nil {
+			t.Fatalf("GetUpdates() returned an error: %v", err)
+		}
+
+		if len(got) != 2 {
+			t.Fatalf("got %d updates, want %d", len(got), 2)
+		}
+
+		if got[1].UpdateID != 11 || got[1].Message.Text != "hello" {
+			t.Errorf("got update %v, want update 11 with text hello", got[1])
+		}
+	})
+}
+
+func TestPollUpdates(t *testing.T) {
+	client, handler, teardown := getTestClient(t)
+	defer teardown()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	bus := eventbus.NewEventBus(logger)
+
+	received := make(chan Update, 2)
+	topic := eventbus.NewTopic[Update]("TelegramUpdate")
+	topic.Subscribe(bus, func(ctx context.Context, u Update) error {
+		received <- u
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	offsets := make(chan int, 3)
+	handler.handler = func(w http.ResponseWriter, r *http.Request) {
+		var got getUpdatesPayload
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("failed to unmarshal request body: %v", err)
+		}
+		offsets <- got.Offset
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		if got.Offset == 0 {
+			io.WriteString(w, `{"ok": true, "result": [{"update_id": 5}, {"update_id": 6}]}`)
+			return
+		}
+
+		cancel()
+		io.WriteString(w, `{"ok": true, "result": []}`)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		client.PollUpdates(ctx, bus, topic)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("PollUpdates() didn't stop after the context was cancelled")
+	}
+
+	if got := <-offsets; got != 0 {
+		t.Errorf("first offset is %d, want %d", got, 0)
+	}
+
+	if got := <-offsets; got != 7 {
+		t.Errorf("second offset is %d, want %d", got, 7)
+	}
+
+	seen := make(map[int]bool)
+	for range 2 {
+		select {
+		case u := <-received:
+			seen[u.UpdateID] = true
+		case <-time.After(5 * time.Second):
+			t.Fatal("updates were not published")
+		}
+	}
+
+	if !seen[5] || !seen[6] {
+		t.Errorf("got updates %v, want 5 and 6", seen)
+	}
+}
@@ -0,0 +1,137 @@
+package telegram
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// limits from https://core.telegram.org/bots/faq#my-bot-is-hitting-limits-how-do-i-avoid-this
+const (
+	globalRate      = 30
+	globalBurst     = 30
+	groupChatRate   = 20.0 / 60
+	privateChatRate = 1
+	chatBurst       = 3
+
+	maxIdleChatBuckets = 1024
+)
+
+type bucket struct {
+	tokens   float64
+	capacity float64
+	rate     float64
+	updated  time.Time
+}
+
+func newBucket(capacity float64, rate float64, now time.Time) *bucket {
+	return &bucket{tokens: capacity, capacity: capacity, rate: rate, updated: now}
+}
+
+func (b *bucket) refill(now time.Time) {
+	elapsed := now.Sub(b.updated).Seconds()
+	b.tokens = math.Min(b.capacity, b.tokens+elapsed*b.rate)
+	b.updated = now
+}
+
+// wait returns how long it takes for the bucket to have a token
+func (b *bucket) wait() time.Duration {
+	if b.tokens >= 1 {
+		return 0
+	}
+
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// rateLimiter queues outgoing requests, so they stay within
+// both the global and per-chat limits of the bot api
+type rateLimiter struct {
+	lock   sync.Mutex
+	global *bucket
+	chats  map[int64]*bucket
+	now    func() time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		global: newBucket(globalBurst, globalRate, time.Now()),
+		chats:  make(map[int64]*bucket),
+		now:    time.Now,
+	}
+}
+
+// Wait blocks until a request to chatID is allowed or ctx is done
+func (l *rateLimiter) Wait(ctx context.Context, chatID int64) error {
+	for {
+		delay := l.reserve(chatID)
+		if delay == 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// reserve takes a token from both buckets if they have one,
+// otherwise it returns how long to wait before trying again
+func (l *rateLimiter) reserve(chatID int64) time.Duration {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := l.now()
+
+	chat, ok := l.chats[chatID]
+	if !ok {
+		l.cleanup(now)
+
+		rate := float64(privateChatRate)
+		if chatID < 0 {
+			rate = groupChatRate
+		}
+
+		chat = newBucket(chatBurst, rate, now)
+		l.chats[chatID] = chat
+	}
+
+	l.global.refill(now)
+	chat.refill(now)
+
+	if delay := max(l.global.wait(), chat.wait()); delay > 0 {
+		return delay
+	}
+
+	l.global.tokens--
+	chat.tokens--
+
+	return 0
+}
+
+// cleanup forgets chats whose buckets are full again,
+// they behave exactly like new ones
+func (l *rateLimiter) cleanup(now time.Time) {
+	if len(l.chats) < maxIdleChatBuckets {
+		return
+	}
+
+	for id, b := range l.chats {
+		b.refill(now)
+		if b.tokens >= b.capacity {
+			delete(l.chats, id)
+		}
+	}
+}
+
+// chatPayload is implemented by request payloads addressed to a chat
+type chatPayload interface {
+	chatID() int64
+}
+
+func (p sendMessagePayload) chatID() int64            { return p.ChatID }
+func (p editMessageReplyMarkupPayload) chatID() int64 { return p.ChatID }
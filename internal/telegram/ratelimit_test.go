@@ -0,0 +1,81 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestRateLimiter() (*rateLimiter, *time.Time) {
+	now := time.Date(2025, 1, 4, 9, 0, 0, 0, time.UTC)
+
+	l := newRateLimiter()
+	l.now = func() time.Time { return now }
+	l.global = newBucket(globalBurst, globalRate, now)
+
+	return l, &now
+}
+
+func TestRateLimiterPerChat(t *testing.T) {
+	l, now := newTestRateLimiter()
+
+	for i := range chatBurst {
+		if delay := l.reserve(-1); delay != 0 {
+			t.Fatalf("request %d was delayed by %v, want no delay", i, delay)
+		}
+	}
+
+	delay := l.reserve(-1)
+	if want := 3 * time.Second; delay != want {
+		t.Fatalf("group chat request was delayed by %v, want %v", delay, want)
+	}
+
+	if delay := l.reserve(-2); delay != 0 {
+		t.Fatalf("request to another chat was delayed by %v, want no delay", delay)
+	}
+
+	*now = now.Add(delay)
+
+	if delay := l.reserve(-1); delay != 0 {
+		t.Fatalf("request after waiting was delayed by %v, want no delay", delay)
+	}
+}
+
+func TestRateLimiterGlobal(t *testing.T) {
+	l, now := newTestRateLimiter()
+
+	for i := range globalBurst {
+		if delay := l.reserve(int64(i)); delay != 0 {
+			t.Fatalf("request %d was delayed by %v, want no delay", i, delay)
+		}
+	}
+
+	delay := l.reserve(globalBurst)
+	if delay == 0 {
+		t.Fatal("request over the global limit was not delayed")
+	}
+
+	*now = now.Add(delay)
+
+	if delay := l.reserve(globalBurst); delay != 0 {
+		t.Fatalf("request after waiting was delayed by %v, want no delay", delay)
+	}
+}
+
+func TestRateLimiterWait(t *testing.T) {
+	l, _ := newTestRateLimiter()
+
+	for range chatBurst {
+		if err := l.Wait(context.Background(), -1); err != nil {
+			t.Fatalf("Wait() returned an error: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := l.Wait(ctx, -1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+}
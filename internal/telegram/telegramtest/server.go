@@ -0,0 +1,217 @@
+// Package telegramtest provides a fake bot api server to script
+// whole conversations with the bot in tests
+package telegramtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andrewyazura/duty-reminder/internal/config"
+	"github.com/andrewyazura/duty-reminder/internal/telegram"
+)
+
+const (
+	APIToken     = "test-token"
+	HeaderSecret = "test-secret"
+	BotID        = 1000
+)
+
+// Call is a single request the bot made to the api
+type Call struct {
+	Method  string
+	ChatID  int64
+	Text    string
+	Payload json.RawMessage
+	// MessageID is the id of the sent message for sendMessage calls
+	MessageID int64
+}
+
+// InlineKeyboard decodes the inline keyboard attached to the call, if any
+func (c Call) InlineKeyboard() telegram.InlineKeyboard {
+	var payload struct {
+		ReplyMarkup struct {
+			InlineKeyboard telegram.InlineKeyboard `json:"inline_keyboard"`
+		} `json:"reply_markup"`
+	}
+
+	json.Unmarshal(c.Payload, &payload)
+	return payload.ReplyMarkup.InlineKeyboard
+}
+
+func (c Call) String() string {
+	s := c.Method
+	if c.ChatID != 0 {
+		s += fmt.Sprintf(" %d", c.ChatID)
+	}
+
+	if c.Text != "" {
+		s += ": " + c.Text
+	}
+
+	return s
+}
+
+// Server records every request and answers with plausible results
+type Server struct {
+	*httptest.Server
+
+	lock          sync.Mutex
+	calls         []Call
+	admins        map[int64]bool
+	lastMessageID int64
+}
+
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+
+	s := &Server{admins: make(map[int64]bool)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// Config returns a client config pointing at the fake server
+func (s *Server) Config() config.TelegramConfig {
+	return config.TelegramConfig{
+		APIToken:     APIToken,
+		BaseURL:      s.URL,
+		BotID:        BotID,
+		HeaderSecret: HeaderSecret,
+		Timeout:      5 * time.Second,
+	}
+}
+
+// NewClient returns a client of the fake server that isn't rate limited,
+// config should come from Config
+func (s *Server) NewClient(config *config.TelegramConfig, logger *slog.Logger) *telegram.Client {
+	return telegram.NewClient(config, logger, telegram.WithoutRateLimit())
+}
+
+// SetAdmin makes getChatMember report the user as an administrator
+func (s *Server) SetAdmin(userID int64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.admins[userID] = true
+}
+
+func (s *Server) Calls() []Call {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	calls := make([]Call, len(s.calls))
+	copy(calls, s.calls)
+
+	return calls
+}
+
+// Transcript returns calls of the given methods formatted with Call.String,
+// all calls except getChatMember are included if no methods are given
+func (s *Server) Transcript(methods ...string) []string {
+	var transcript []string
+
+	for _, c := range s.Calls() {
+		if len(methods) == 0 && c.Method == "getChatMember" {
+			continue
+		}
+
+		if len(methods) > 0 && !slices.Contains(methods, c.Method) {
+			continue
+		}
+
+		transcript = append(transcript, c.String())
+	}
+
+	return transcript
+}
+
+// WaitForCalls waits until at least n calls were made and returns them
+func (s *Server) WaitForCalls(t testing.TB, n int) []Call {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		calls := s.Calls()
+		if len(calls) >= n {
+			return calls
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d calls, want %d: %v", len(calls), n, calls)
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// Reset forgets all recorded calls
+func (s *Server) Reset() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.calls = nil
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, "/bot"+APIToken+"/") {
+		w.WriteHeader(http.StatusUnauthorized)
+		io.WriteString(w, `{"ok": false, "error_code": 401, "description": "Unauthorized"}`)
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+
+	var payload struct {
+		ChatID int64  `json:"chat_id"`
+		UserID int64  `json:"user_id"`
+		Text   string `json:"text"`
+	}
+	json.Unmarshal(body, &payload)
+
+	call := Call{
+		Method:  path.Base(r.URL.Path),
+		ChatID:  payload.ChatID,
+		Text:    payload.Text,
+		Payload: body,
+	}
+
+	s.lock.Lock()
+
+	var result any = true
+	switch call.Method {
+	case "sendMessage":
+		s.lastMessageID++
+		call.MessageID = s.lastMessageID
+		result = telegram.Message{
+			MessageID: s.lastMessageID,
+			Chat:      telegram.Chat{ID: payload.ChatID, Type: "supergroup"},
+			Text:      payload.Text,
+		}
+	case "getChatMember":
+		status := "member"
+		if s.admins[payload.UserID] {
+			status = "administrator"
+		}
+
+		result = telegram.ChatMember{Status: status, User: telegram.User{ID: payload.UserID}}
+	case "getMe":
+		result = telegram.User{ID: BotID, Username: "test_bot", FirstName: "Test Bot"}
+	}
+
+	s.calls = append(s.calls, call)
+	s.lock.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"ok": true, "result": result})
+}
@@ -0,0 +1,138 @@
+package telegramtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode"
+
+	"github.com/andrewyazura/duty-reminder/internal/eventbus"
+	"github.com/andrewyazura/duty-reminder/internal/server"
+	"github.com/andrewyazura/duty-reminder/internal/telegram"
+)
+
+// Webhook delivers updates through the real webhook handler
+type Webhook struct {
+	handler       *server.TelegramWebhookHandler
+	lastUpdateID  int
+	lastMessageID int64
+}
+
+func (s *Server) NewWebhook(bus *eventbus.EventBus) *Webhook {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	return &Webhook{
+		handler: server.NewTelegramWebhookHandler(s.Config(), logger, bus),
+	}
+}
+
+// Send posts the update like telegram would, filling in update and message ids
+func (w *Webhook) Send(t testing.TB, update telegram.Update) {
+	t.Helper()
+
+	w.lastUpdateID++
+	update.UpdateID = w.lastUpdateID
+
+	if update.Message != nil && update.Message.MessageID == 0 {
+		w.lastMessageID++
+		update.Message.MessageID = w.lastMessageID
+	}
+
+	body, err := json.Marshal(update)
+	if err != nil {
+		t.Fatalf("failed to marshal update: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/telegram/secret", bytes.NewReader(body))
+	req.Header.Set("X-Telegram-Bot-Api-Secret-Token", HeaderSecret)
+
+	rec := httptest.NewRecorder()
+	w.handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("webhook responded with %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func User(id int64, firstName string) telegram.User {
+	return telegram.User{ID: id, FirstName: firstName}
+}
+
+func groupChat(chatID int64) telegram.Chat {
+	return telegram.Chat{ID: chatID, Type: "supergroup"}
+}
+
+// BotAdded is the update sent when the bot is added to a group
+func BotAdded(chatID int64, by telegram.User) telegram.Update {
+	return telegram.Update{
+		Message: &telegram.Message{
+			Chat:           groupChat(chatID),
+			From:           by,
+			NewChatMembers: []telegram.User{{ID: BotID, FirstName: "Test Bot"}},
+		},
+	}
+}
+
+// MemberLeft is the update sent when a user leaves a group
+func MemberLeft(chatID int64, user telegram.User) telegram.Update {
+	return telegram.Update{
+		Message: &telegram.Message{
+			Chat:           groupChat(chatID),
+			From:           user,
+			LeftChatMember: &user,
+		},
+	}
+}
+
+// Command is a message starting with a bot command, e.g. "/skip swap".
+// Words starting with @ get mention entities like telegram adds them
+func Command(chatID int64, from telegram.User, text string) telegram.Update {
+	command := text
+	if i := strings.IndexFunc(text, unicode.IsSpace); i > -1 {
+		command = text[:i]
+	}
+
+	entities := []telegram.MessageEntity{
+		{Type: "bot_command", Offset: 0, Length: len(command)},
+	}
+
+	offset := len(command)
+	for _, word := range strings.Fields(text[len(command):]) {
+		offset += strings.Index(text[offset:], word)
+
+		if strings.HasPrefix(word, "@") {
+			entities = append(entities, telegram.MessageEntity{Type: "mention", Offset: offset, Length: len(word)})
+		}
+
+		offset += len(word)
+	}
+
+	return telegram.Update{
+		Message: &telegram.Message{
+			Chat:     groupChat(chatID),
+			From:     from,
+			Text:     text,
+			Entities: entities,
+		},
+	}
+}
+
+// Callback is a tap on an inline keyboard button of a bot's message
+func Callback(chatID int64, from telegram.User, messageID int64, data string) telegram.Update {
+	return telegram.Update{
+		CallbackQuery: &telegram.CallbackQuery{
+			ID:   "callback-" + data,
+			From: from,
+			Message: telegram.Message{
+				MessageID: messageID,
+				Chat:      groupChat(chatID),
+			},
+			Data: data,
+		},
+	}
+}
@@ -11,9 +11,23 @@ type Update struct {
 	CallbackQuery *CallbackQuery `json:"callback_query"`
 }
 
+// ChatID returns the chat the update came from, or 0 if it has none
+func (u Update) ChatID() int64 {
+	switch {
+	case u.Message != nil:
+		return u.Message.Chat.ID
+	case u.CallbackQuery != nil:
+		return u.CallbackQuery.Message.Chat.ID
+	default:
+		return 0
+	}
+}
+
 type Message struct {
 	MessageID      int64           `json:"message_id"`
 	NewChatMembers []User          `json:"new_chat_members"`
+	LeftChatMember *User           `json:"left_chat_member"`
+	ReplyToMessage *Message        `json:"reply_to_message"`
 	Chat           Chat            `json:"chat"`
 	From           User            `json:"from"`
 	Text           string          `json:"text"`
@@ -37,6 +51,7 @@ type MessageEntity struct {
 	Type   string `json:"type"`
 	Offset int    `json:"offset"`
 	Length int    `json:"length"`
+	User   *User  `json:"user"`
 }
 
 func (e MessageEntity) Text(m *Message) string {
@@ -49,6 +64,15 @@ func (e MessageEntity) Text(m *Message) string {
 	return text
 }
 
+type ChatMember struct {
+	Status string `json:"status"`
+	User   User   `json:"user"`
+}
+
+func (m ChatMember) IsAdmin() bool {
+	return m.Status == "creator" || m.Status == "administrator"
+}
+
 type CallbackQuery struct {
 	ID      string  `json:"id"`
 	From    User    `json:"from"`
@@ -102,3 +126,49 @@ type answerCallbackQueryPayload struct {
 	Text      *string `json:"text,omitempty"`
 	ShowAlert *bool   `json:"show_alert,omitempty"`
 }
+
+type getChatMemberPayload struct {
+	ChatID int64 `json:"chat_id"`
+	UserID int64 `json:"user_id"`
+}
+
+type getUpdatesPayload struct {
+	Offset         int      `json:"offset,omitempty"`
+	Timeout        int      `json:"timeout"`
+	AllowedUpdates []string `json:"allowed_updates,omitempty"`
+}
+
+type WebhookInfo struct {
+	URL                  string `json:"url"`
+	PendingUpdateCount   int    `json:"pending_update_count"`
+	LastErrorDate        int64  `json:"last_error_date"`
+	LastErrorMessage     string `json:"last_error_message"`
+	HasCustomCertificate bool   `json:"has_custom_certificate"`
+}
+
+type BotCommand struct {
+	Command     string `json:"command"`
+	Description string `json:"description"`
+}
+
+type setWebhookPayload struct {
+	URL string `json:"url"`
+
+	SecretToken        *string  `json:"secret_token,omitempty"`
+	AllowedUpdates     []string `json:"allowed_updates,omitempty"`
+	DropPendingUpdates *bool    `json:"drop_pending_updates,omitempty"`
+}
+
+type deleteWebhookPayload struct {
+	DropPendingUpdates *bool `json:"drop_pending_updates,omitempty"`
+}
+
+type setMyCommandsPayload struct {
+	Commands []BotCommand `json:"commands"`
+
+	Scope *botCommandScope `json:"scope,omitempty"`
+}
+
+type botCommandScope struct {
+	Type string `json:"type"`
+}
@@ -18,3 +18,21 @@ func TestMessageEntity_Text(t *testing.T) {
 		t.Fatalf("got %s, want %s", command, "register")
 	}
 }
+
+func TestUpdate_ChatID(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		update Update
+		want   int64
+	}{
+		{"message", Update{Message: &Message{Chat: Chat{ID: -1}}}, -1},
+		{"callback query", Update{CallbackQuery: &CallbackQuery{Message: Message{Chat: Chat{ID: -2}}}}, -2},
+		{"empty", Update{}, 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.update.ChatID(); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"path/filepath"
 	"strconv"
 
+	"github.com/andrewyazura/duty-reminder/internal/migrations"
 	"github.com/jackc/pgx/v5"
 )
 
@@ -39,8 +40,11 @@ func NewTempPostgresInstance(logger *slog.Logger, dbname string, user string, po
 
 func (pg *TempPostgresInstance) Setup() error {
 	if pg.isRunning() {
-		_, err := pg.connect()
-		return err
+		if _, err := pg.connect(); err != nil {
+			return err
+		}
+
+		return pg.migrate()
 	}
 
 	if !pg.isInitialized() {
@@ -65,6 +69,11 @@ func (pg *TempPostgresInstance) Setup() error {
 		return err
 	}
 
+	if err := pg.migrate(); err != nil {
+		pg.logger.Error("failed to apply migrations", "error", err)
+		return err
+	}
+
 	return nil
 }
 
@@ -110,6 +119,15 @@ func (pg *TempPostgresInstance) connect() (*pgx.Conn, error) {
 	return conn, err
 }
 
+func (pg *TempPostgresInstance) migrate() error {
+	migrator, err := migrations.New(pg.Connection, pg.logger)
+	if err != nil {
+		return err
+	}
+
+	return migrator.Up(context.Background())
+}
+
 func (pg *TempPostgresInstance) close() error {
 	if pg.Connection != nil {
 		if err := pg.Connection.Close(context.Background()); err != nil {